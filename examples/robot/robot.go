@@ -1,15 +1,16 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
 	"io"
+	"iter"
+	"sync/atomic"
 
 	"github.com/WuKongIM/go-pdk/pdk"
 	"github.com/WuKongIM/wklog"
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/utils"
 	"github.com/volcengine/volcengine-go-sdk/volcengine"
 	"go.uber.org/zap"
 )
@@ -27,12 +28,13 @@ func main() {
 
 type Config struct {
 	ApiKey pdk.SecretKey `json:"api_key" label:"Volcengine API Key"`
+	Model  string        `json:"model" label:"模型" default:"deepseek-r1-250120"`
 }
 
 type Robot struct {
 	wklog.Log
-	client *arkruntime.Client
-	Config Config // 插件的配置，名字必须为Config, 声明了以后，可以在WuKongIM后台配置
+	client atomic.Pointer[arkruntime.Client]
+	Config Config // 声明插件的配置类型，名字必须为Config, 声明了以后，可以在WuKongIM后台配置（通过 pdk.ConfigFrom[Config](c.Host()) 读取）
 }
 
 func New() interface{} {
@@ -41,15 +43,13 @@ func New() interface{} {
 	}
 }
 
-func (r *Robot) Setup() {
-	r.client = arkruntime.NewClientWithApiKey(
-		r.Config.ApiKey.String(),
-	)
-
-}
-
-func (r *Robot) ConfigUpdate() {
-	fmt.Println("config update...", r.Config.ApiKey)
+// ConfigUpdate 配置变更后调用（启动时也会调用一次），API Key 变化时重新创建客户端
+func (r *Robot) ConfigUpdate(old, new Config) {
+	if r.client.Load() != nil && old.ApiKey == new.ApiKey {
+		return
+	}
+	r.client.Store(arkruntime.NewClientWithApiKey(new.ApiKey.String()))
+	r.Info("config updated")
 }
 
 // 实现插件的回复消息方法
@@ -67,9 +67,11 @@ func (r *Robot) Receive(c *pdk.Context) {
 		content = payload["content"].(string)
 	}
 
+	// 读取当前配置的快照，与配置更新并发时也是安全的
+	cfg := pdk.ConfigFrom[Config](c.Host())
 	req := model.CreateChatCompletionRequest{
 		User:  &c.RecvPacket.FromUid,
-		Model: "deepseek-r1-250120",
+		Model: cfg.Model,
 		Messages: []*model.ChatCompletionMessage{
 			{
 				Role: model.ChatMessageRoleSystem,
@@ -85,17 +87,15 @@ func (r *Robot) Receive(c *pdk.Context) {
 			},
 		},
 	}
-	ctx := context.Background()
-	stream, err := r.client.CreateChatCompletionStream(ctx, req)
+	// 请求结束（超时或插件停止）时停止调用模型
+	stream, err := r.client.Load().CreateChatCompletionStream(c.Context(), req)
 	if err != nil {
-		fmt.Printf("standard chat error: %v\n", err)
+		r.Error("create chat completion stream error:", zap.Error(err))
 		return
 	}
-
 	defer stream.Close()
 
 	//打开流
-
 	imstream, err := c.OpenStream(pdk.StreamWithPayload(&pdk.PayloadText{
 		Content: "正在思考中...",
 		Type:    1,
@@ -104,33 +104,32 @@ func (r *Robot) Receive(c *pdk.Context) {
 		r.Error("open stream error:", zap.Error(err))
 		return
 	}
-	defer imstream.Close()
-
-	for {
-		recv, err := stream.Recv()
-		if err == io.EOF {
-			return
-		}
-		if err != nil {
-			fmt.Printf("Stream chat error: %v\n", err)
-			return
-		}
 
-		if len(recv.Choices) > 0 {
+	// 将模型的回复逐段写入流，结束后以完整的回复关闭流
+	_, err = imstream.Pipe(deltas(stream), pdk.PipeWithErrorMessage("\n\n回复出错了，请稍后再试"))
+	if err != nil {
+		r.Error("stream chat error:", zap.Error(err))
+	}
+}
 
-			content := recv.Choices[0].Delta.Content
-			if content == "" {
+// deltas 模型逐段返回的回复内容
+func deltas(stream *utils.ChatCompletionStreamReader) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for {
+			recv, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if len(recv.Choices) == 0 || recv.Choices[0].Delta.Content == "" {
 				continue
 			}
-
-			fmt.Print(content)
-
-			data, _ := json.Marshal(map[string]interface{}{
-				"type":    1,
-				"content": content,
-			})
-			imstream.Write(data)
+			if !yield(recv.Choices[0].Delta.Content, nil) {
+				return
+			}
 		}
 	}
-
 }
@@ -9,16 +9,17 @@ require (
 	github.com/volcengine/volcengine-go-sdk v1.0.183
 	go.uber.org/zap v1.27.0
 	google.golang.org/protobuf v1.36.3
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 require (
+	github.com/RussellLuo/timingwheel v0.0.0-20220218152713-54845bda3108 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/kr/pretty v0.3.0 // indirect
+	github.com/lni/goutils v1.4.0 // indirect
 	github.com/panjf2000/ants/v2 v2.11.0 // indirect
 	github.com/panjf2000/gnet/v2 v2.7.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/rogpeppe/go-internal v1.8.1 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/volcengine/volc-sdk-golang v1.0.23 // indirect
 	go.etcd.io/etcd/pkg/v3 v3.5.17 // indirect
@@ -27,5 +28,4 @@ require (
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
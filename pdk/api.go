@@ -2,12 +2,13 @@ package pdk
 
 import (
 	"encoding/json"
-	"syscall"
+	"errors"
 
 	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
 	"github.com/WuKongIM/wkrpc/client"
 	"github.com/WuKongIM/wkrpc/proto"
 	"go.uber.org/zap"
+	gproto "google.golang.org/protobuf/proto"
 )
 
 func (s *Server) routes() {
@@ -30,7 +31,10 @@ func (s *Server) onMessage() {
 				s.Error("unmarshal message batch error", zap.Error(err))
 				return
 			}
-			s.handlePersistAfter(messages)
+			err = s.handlePersistAfter(messages)
+			if err != nil {
+				s.Error("handle persist after error", zap.Error(err))
+			}
 		case uint32(PluginMethodTypeReceive):
 			recvPacket := &pluginproto.RecvPacket{}
 			err := recvPacket.Unmarshal(msg.Content)
@@ -38,12 +42,21 @@ func (s *Server) onMessage() {
 				s.Error("unmarshal recv packet error", zap.Error(err))
 				return
 			}
-			s.handleReceive(recvPacket)
+			err = s.handleReceive(recvPacket)
+			if err != nil {
+				s.Error("handle receive error", zap.Error(err))
+			}
 		}
 	})
 }
 
 func (s *Server) send(c *client.Context) {
+	if !s.beginWork() {
+		c.WriteErr(ErrShuttingDown)
+		return
+	}
+	defer s.endWork()
+
 	sendPacket := &pluginproto.SendPacket{}
 	err := sendPacket.Unmarshal(c.Body())
 	if err != nil {
@@ -52,8 +65,29 @@ func (s *Server) send(c *client.Context) {
 		return
 	}
 
-	ctx := newSendContext(s, sendPacket)
-	s.plugin.send(ctx)
+	// fail-open时需要保留原始的发送包
+	var original *pluginproto.SendPacket
+	if s.opts.SendPanicPolicy == SendFailOpen {
+		original = gproto.Clone(sendPacket).(*pluginproto.SendPacket)
+	}
+
+	reqCtx, cancel := requestContext(s.ctx, s.opts.RequestTimeout)
+	defer cancel()
+	ctx := NewSendContext(s, sendPacket)
+	ctx.SetContext(reqCtx)
+	err = s.plugin.safeCall(PluginSend, sendPacketFields(sendPacket), func() {
+		s.plugin.send(ctx)
+	})
+	if err != nil {
+		if original == nil {
+			c.WriteErr(err)
+			return
+		}
+		sendPacket = original
+	} else if ctx.Err() != nil {
+		c.WriteErr(ctx.Err())
+		return
+	}
 
 	resultData, err := sendPacket.Marshal()
 	if err != nil {
@@ -73,7 +107,11 @@ func (s *Server) persistAfter(c *client.Context) {
 		return
 	}
 
-	s.handlePersistAfter(messages)
+	err = s.handlePersistAfter(messages)
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
 	c.WriteOk()
 }
 
@@ -85,20 +123,59 @@ func (s *Server) receive(c *client.Context) {
 		c.WriteErr(err)
 		return
 	}
-	s.handleReceive(recvPacket)
+	err = s.handleReceive(recvPacket)
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
+	// 与persistAfter一致，处理完成后应答，否则同步请求的服务端只能等到超时
+	c.WriteOk()
 }
 
-func (s *Server) handlePersistAfter(messageBatch *pluginproto.MessageBatch) {
-	ctx := newMessageContext(s, messageBatch.Messages)
-	s.plugin.persistAfter(ctx)
+func (s *Server) handlePersistAfter(messageBatch *pluginproto.MessageBatch) error {
+	if !s.beginWork() {
+		return ErrShuttingDown
+	}
+	defer s.endWork()
+
+	reqCtx, cancel := requestContext(s.ctx, s.opts.RequestTimeout)
+	defer cancel()
+	ctx := NewMessageContext(s, messageBatch.Messages)
+	ctx.SetContext(reqCtx)
+	err := s.plugin.safeCall(PluginPersistAfter, messagesFields(messageBatch.Messages), func() {
+		s.plugin.persistAfter(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
 }
 
-func (s *Server) handleReceive(recvPacket *pluginproto.RecvPacket) {
-	ctx := newRecvContext(s, recvPacket)
-	s.plugin.receive(ctx)
+func (s *Server) handleReceive(recvPacket *pluginproto.RecvPacket) error {
+	if !s.beginWork() {
+		return ErrShuttingDown
+	}
+	defer s.endWork()
+
+	reqCtx, cancel := requestContext(s.ctx, s.opts.RequestTimeout)
+	defer cancel()
+	ctx := NewRecvContext(s, recvPacket)
+	ctx.SetContext(reqCtx)
+	err := s.plugin.safeCall(PluginReceive, recvPacketFields(recvPacket), func() {
+		s.plugin.receive(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
 }
 
 func (s *Server) route(c *client.Context) {
+	if !s.beginWork() {
+		c.WriteErr(ErrShuttingDown)
+		return
+	}
+	defer s.endWork()
 
 	req := &pluginproto.HttpRequest{}
 	err := req.Unmarshal(c.Body())
@@ -108,15 +185,20 @@ func (s *Server) route(c *client.Context) {
 		return
 	}
 
-	ctx := &HttpContext{
-		Request: req,
-		Response: &pluginproto.HttpResponse{
-			Headers: map[string]string{},
-		},
-	}
+	reqCtx, cancel := requestContext(s.ctx, s.opts.RequestTimeout)
+	defer cancel()
+	ctx := NewHttpContext(s, req)
+	ctx.SetContext(reqCtx)
+	defer ctx.removeMultipartForm()
 
 	// route
-	s.plugin.route(ctx)
+	err = s.plugin.safeCall(PluginRoute, httpRequestFields(req), func() {
+		s.plugin.route(ctx)
+	})
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
 
 	// response
 	data, err := ctx.Response.Marshal()
@@ -134,7 +216,7 @@ func (s *Server) handleStop(c *client.Context) {
 	s.Info("Server actively stops the plugin")
 
 	select {
-	case s.sigChan <- syscall.SIGTERM:
+	case s.stopC <- struct{}{}:
 	default:
 	}
 	c.WriteOk()
@@ -142,13 +224,30 @@ func (s *Server) handleStop(c *client.Context) {
 
 func (s *Server) handleConfigUpdate(c *client.Context) {
 
-	var config map[string]interface{}
-	err := json.Unmarshal(c.Body(), &config)
+	config, err := decodeConfig(c.Body())
 	if err != nil {
 		s.Error("unmarshal config error", zap.Error(err))
 		c.WriteErr(err)
 		return
 	}
-	s.plugin.configUpdate(config)
+	var updateErr error
+	err = s.plugin.safeCall(PluginConfigUpdate, nil, func() {
+		updateErr = s.plugin.applyConfig(config, true)
+	})
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
+	// 配置无效时将每个字段的错误以json格式返回给服务端
+	var cfgErr *ConfigError
+	if errors.As(updateErr, &cfgErr) {
+		data, _ := json.Marshal(cfgErr)
+		c.WriteErr(errors.New(string(data)))
+		return
+	}
+	if updateErr != nil {
+		c.WriteErr(updateErr)
+		return
+	}
 	c.WriteOk()
 }
@@ -0,0 +1,497 @@
+package pdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 常用的Content-Type
+const (
+	MIMEJSON              = "application/json"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+
+	// multipart表单在内存中保存的最大字节数，超出的文件会写入临时文件
+	defaultMultipartMemory = 32 << 20
+)
+
+// ContentType 请求的Content-Type（不含charset等参数）
+func (h *HttpContext) ContentType() string {
+	ct := h.GetHeader("Content-Type")
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// parseForm 解析urlencoded或multipart请求体，结果会被缓存
+func (h *HttpContext) parseForm() (url.Values, error) {
+	if h.form != nil {
+		return h.form, nil
+	}
+	switch h.ContentType() {
+	case MIMEPOSTForm:
+		form, err := url.ParseQuery(string(h.Request.Body))
+		if err != nil {
+			return nil, err
+		}
+		h.form = form
+	case MIMEMultipartPOSTForm:
+		_, params, err := mime.ParseMediaType(h.GetHeader("Content-Type"))
+		if err != nil {
+			return nil, err
+		}
+		boundary := params["boundary"]
+		if boundary == "" {
+			return nil, http.ErrMissingBoundary
+		}
+		mf, err := multipart.NewReader(bytes.NewReader(h.Request.Body), boundary).ReadForm(defaultMultipartMemory)
+		if err != nil {
+			return nil, err
+		}
+		h.multipartForm = mf
+		h.form = url.Values(mf.Value)
+	default:
+		h.form = url.Values{}
+	}
+	return h.form, nil
+}
+
+// removeMultipartForm 删除multipart表单的临时文件
+func (h *HttpContext) removeMultipartForm() {
+	if h.multipartForm == nil {
+		return
+	}
+	if err := h.multipartForm.RemoveAll(); err != nil {
+		hostLog(h.host, "HttpContext").Warn("remove multipart form error", zap.Error(err))
+	}
+}
+
+// PostForm 获取urlencoded或multipart表单中的值，不存在时返回空字符串
+func (h *HttpContext) PostForm(key string) string {
+	form, err := h.parseForm()
+	if err != nil {
+		return ""
+	}
+	return form.Get(key)
+}
+
+// PostFormArray 获取表单中某个key的所有值
+func (h *HttpContext) PostFormArray(key string) []string {
+	form, err := h.parseForm()
+	if err != nil {
+		return nil
+	}
+	return form[key]
+}
+
+// MultipartForm 解析multipart表单（包含上传的文件）
+//
+// 超出内存限制的文件会写入临时文件，处理函数返回后删除，需要在处理函数返回前读取。
+func (h *HttpContext) MultipartForm() (*multipart.Form, error) {
+	if _, err := h.parseForm(); err != nil {
+		return nil, err
+	}
+	if h.multipartForm == nil {
+		return nil, http.ErrNotMultipart
+	}
+	return h.multipartForm, nil
+}
+
+// FormFile 获取multipart表单中上传的第一个文件，见 MultipartForm
+func (h *HttpContext) FormFile(name string) (*multipart.FileHeader, error) {
+	mf, err := h.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := mf.File[name]
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// BindQuery 将查询参数按 form 标签填充到结构体中（不做校验）
+//
+//	type Query struct {
+//		ChannelId string `form:"channel_id"`
+//		Limit     int    `form:"limit"`
+//	}
+func (h *HttpContext) BindQuery(obj interface{}) error {
+	values := make(map[string][]string, len(h.Request.Query))
+	for k, v := range h.Request.Query {
+		values[k] = []string{v}
+	}
+	return mapForm(obj, values)
+}
+
+// BindForm 将查询参数和urlencoded、multipart表单按 form 标签填充到结构体中（不做校验），表单中的值优先
+func (h *HttpContext) BindForm(obj interface{}) error {
+	form, err := h.parseForm()
+	if err != nil {
+		return err
+	}
+	values := make(map[string][]string, len(h.Request.Query)+len(form))
+	for k, v := range h.Request.Query {
+		values[k] = []string{v}
+	}
+	for k, v := range form {
+		values[k] = v
+	}
+	return mapForm(obj, values)
+}
+
+// ShouldBind 根据请求方法和Content-Type选择绑定方式，然后按 binding 标签校验
+//
+// GET、HEAD、DELETE 请求或没有请求体时绑定查询参数；
+// urlencoded、multipart 请求绑定表单；其他情况按JSON解析请求体。
+// 校验失败时返回 FieldErrors。
+func (h *HttpContext) ShouldBind(obj interface{}) error {
+	method := strings.ToUpper(h.Request.Method)
+	switch {
+	case method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete || len(h.Request.Body) == 0:
+		return h.ShouldBindQuery(obj)
+	case h.ContentType() == MIMEPOSTForm || h.ContentType() == MIMEMultipartPOSTForm:
+		if err := h.BindForm(obj); err != nil {
+			return err
+		}
+		return validate(obj)
+	default:
+		return h.ShouldBindJSON(obj)
+	}
+}
+
+// ShouldBindQuery 绑定查询参数并按 binding 标签校验
+func (h *HttpContext) ShouldBindQuery(obj interface{}) error {
+	if err := h.BindQuery(obj); err != nil {
+		return err
+	}
+	return validate(obj)
+}
+
+// ShouldBindJSON 按JSON解析请求体并按 binding 标签校验
+func (h *HttpContext) ShouldBindJSON(obj interface{}) error {
+	if len(h.Request.Body) > 0 {
+		if err := json.Unmarshal(h.Request.Body, obj); err != nil {
+			return err
+		}
+	}
+	return validate(obj)
+}
+
+// FieldError 字段错误
+type FieldError struct {
+	Field   string `json:"field"`   // 字段名
+	Message string `json:"message"` // 错误信息
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// FieldErrors 字段错误列表
+type FieldErrors []*FieldError
+
+func (es FieldErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// mapForm 将表单（或查询参数）的值按 form 标签填充到结构体中，未设置form标签时使用字段名
+func mapForm(obj interface{}, values map[string][]string) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("bind target must be a non-nil pointer to struct")
+	}
+	return mapFormStruct(v.Elem(), values)
+}
+
+func mapFormStruct(v reflect.Value, values map[string][]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// ignore unexported fields
+		if len(field.PkgPath) != 0 {
+			continue
+		}
+		fieldValue := v.Field(i)
+
+		name := tagName(field, "form")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && fieldValue.Kind() == reflect.Struct && field.Tag.Get("form") == "" {
+			if err := mapFormStruct(fieldValue, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		if err := setFormValue(fieldValue, vals); err != nil {
+			return &FieldError{Field: name, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+func setFormValue(v reflect.Value, vals []string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFormValue(v.Elem(), vals)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setStringValue(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setStringValue(v, vals[0])
+}
+
+// setStringValue 将字符串转换为字段的类型并赋值
+func setStringValue(v reflect.Value, val string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setStringValue(v.Elem(), val)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// tagName 获取字段在标签中的名字（去掉 omitempty 等选项），未设置时使用字段名
+func tagName(field reflect.StructField, tag string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validate 按 binding 标签校验结构体
+//
+// 支持的规则（多个规则用逗号分隔）：
+//
+//	required     不能为零值
+//	min=n,max=n  数字的取值范围；字符串、切片、map的长度范围
+//	len=n        字符串、切片、map的长度；数字的取值
+//	oneof=a b c  取值只能是其中之一（零值不校验）
+func validate(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs FieldErrors
+	visited := map[visitKey]bool{}
+	if v.CanAddr() {
+		visited[visitKey{ptr: v.UnsafeAddr(), typ: v.Type()}] = true
+	}
+	validateStruct(v, "", &errs, visited)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// visitKey 已校验的结构体（通过指针访问的），避免自引用的结构体无限递归
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *FieldErrors, visited map[visitKey]bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// ignore unexported fields
+		if len(field.PkgPath) != 0 {
+			continue
+		}
+		fieldValue := v.Field(i)
+		name := prefix + fieldName(field)
+
+		if rules := field.Tag.Get("binding"); rules != "" && rules != "-" {
+			for _, rule := range strings.Split(rules, ",") {
+				if msg := checkRule(fieldValue, strings.TrimSpace(rule)); msg != "" {
+					*errs = append(*errs, &FieldError{Field: name, Message: msg})
+					break
+				}
+			}
+		}
+
+		// 嵌套的结构体
+		fv := fieldValue
+		seen := false
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+			key := visitKey{ptr: fv.UnsafeAddr(), typ: fv.Type()}
+			if visited[key] {
+				seen = true
+				break
+			}
+			visited[key] = true
+		}
+		if !seen && fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			validateStruct(fv, name+".", errs, visited)
+		}
+	}
+}
+
+// fieldName 错误信息中的字段名，依次使用 json、form 标签和字段名
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func checkRule(v reflect.Value, rule string) string {
+	name, param, _ := strings.Cut(rule, "=")
+	switch name {
+	case "":
+		return ""
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+
+	// 其他规则不校验未设置的指针
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return fmt.Sprintf("invalid rule %s", rule)
+		}
+		n, isLen, ok := measure(v)
+		if !ok {
+			return ""
+		}
+		what := "value"
+		if isLen {
+			what = "length"
+		}
+		switch {
+		case name == "min" && n < limit:
+			return fmt.Sprintf("%s must be at least %s", what, param)
+		case name == "max" && n > limit:
+			return fmt.Sprintf("%s must be at most %s", what, param)
+		case name == "len" && n != limit:
+			if isLen {
+				return fmt.Sprintf("length must be %s", param)
+			}
+			return fmt.Sprintf("value must equal %s", param)
+		}
+	case "oneof":
+		// 未设置的值由 required 校验
+		if v.IsZero() {
+			return ""
+		}
+		options := strings.Fields(param)
+		val := fmt.Sprint(v.Interface())
+		for _, o := range options {
+			if o == val {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", strings.Join(options, " "))
+	default:
+		return fmt.Sprintf("unknown rule %s", name)
+	}
+	return ""
+}
+
+// measure 获取用于min、max、len校验的值，字符串、切片、map为长度
+func measure(v reflect.Value) (n float64, isLen bool, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
@@ -0,0 +1,115 @@
+package pdk
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"os"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func TestRemoveMultipartForm(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fw, err := w.CreateFormFile("file", "large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 超出内存限制，写入临时文件
+	if _, err := fw.Write(make([]byte, defaultMultipartMemory+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewHttpContext(nil, &pluginproto.HttpRequest{
+		Method:  "POST",
+		Path:    "/upload",
+		Headers: map[string]string{"Content-Type": w.FormDataContentType()},
+		Body:    body.Bytes(),
+	})
+	fh, err := c.FormFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, ok := f.(*os.File)
+	if !ok {
+		t.Fatalf("expected a temp file, got %T", f)
+	}
+	name := tmp.Name()
+	f.Close()
+
+	c.removeMultipartForm()
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("temp file was not removed: %v", err)
+	}
+}
+
+type validateNode struct {
+	Name string        `json:"name" binding:"required"`
+	Next *validateNode `json:"next"`
+}
+
+type validateRules struct {
+	Code  string `json:"code" binding:"len=4"`
+	Level int    `json:"level" binding:"len=3"`
+	Score *int   `json:"score" binding:"min=1,max=10"`
+}
+
+func TestValidateSelfReferential(t *testing.T) {
+	a := &validateNode{Name: "a"}
+	b := &validateNode{Next: a}
+	a.Next = b
+
+	err := validate(a)
+	var errs FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected field errors, got %v", err)
+	}
+	// 每个节点只校验一次
+	if len(errs) != 1 || errs[0].Field != "next.name" {
+		t.Fatalf("errors: %v", errs)
+	}
+
+	self := &validateNode{Name: "self"}
+	self.Next = self
+	if err := validate(self); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateRuleMessages(t *testing.T) {
+	score := 11
+	tests := []struct {
+		name  string
+		obj   validateRules
+		field string
+		msg   string
+	}{
+		{name: "string len", obj: validateRules{Code: "abc", Level: 3}, field: "code", msg: "length must be 4"},
+		{name: "number len", obj: validateRules{Code: "abcd", Level: 2}, field: "level", msg: "value must equal 3"},
+		{name: "pointer max", obj: validateRules{Code: "abcd", Level: 3, Score: &score}, field: "score", msg: "value must be at most 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs FieldErrors
+			if !errors.As(validate(&tt.obj), &errs) {
+				t.Fatal("expected field errors")
+			}
+			if len(errs) != 1 || errs[0].Field != tt.field || errs[0].Message != tt.msg {
+				t.Fatalf("errors: %v", errs)
+			}
+		})
+	}
+	if err := validate(&validateRules{Code: "abcd", Level: 3}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package pdk
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Plugin 显式注册钩子、路由和配置的插件
+//
+// 与 RunServer 通过反射查找方法不同，所有的处理函数都在编译期检查类型：
+//
+//	err := pdk.New("wk.plugin.ai").
+//		OnReceive(func(c *pdk.Context) { ... }).
+//		Routes(func(r *pdk.Route) { ... }).
+//		WithConfig(pdk.TypedConfig(func(old, new Config) { ... })).
+//		Run()
+//
+// 在处理函数中通过 pdk.ConfigFrom[Config](c.Host()) 获取当前的配置。多个独立的功能可以拆分为模块，见 Module。
+type Plugin struct {
+	no     string
+	hooks  map[PluginMethod]func(*Context)
+	routes func(*Route)
+	setup  func()
+	stop   func()
+	host   func(HostAPI)
+	config *ConfigBinding
+
+	instance           interface{} // RunServer 的插件实例，配置会写入它的 Config 字段，见 NewFromInstance
+	legacyConfigUpdate func()      // 插件实例的 ConfigUpdate() 方法
+}
+
+// New 创建插件，no 为插件唯一编号
+func New(no string) *Plugin {
+	return &Plugin{
+		no:    no,
+		hooks: map[PluginMethod]func(*Context){},
+	}
+}
+
+// OnSend 注册发送消息的钩子，可以修改 c.SendPacket
+func (p *Plugin) OnSend(handler func(*Context)) *Plugin {
+	return p.hook(PluginSend, handler)
+}
+
+// OnSendE 注册返回错误的发送消息钩子，返回的错误会返回给服务端
+func (p *Plugin) OnSendE(handler func(*Context) error) *Plugin {
+	return p.hook(PluginSend, hookHandlerE(handler))
+}
+
+// OnPersistAfter 注册消息存储后的钩子
+func (p *Plugin) OnPersistAfter(handler func(*Context)) *Plugin {
+	return p.hook(PluginPersistAfter, handler)
+}
+
+// OnPersistAfterE 注册返回错误的消息存储后钩子
+func (p *Plugin) OnPersistAfterE(handler func(*Context) error) *Plugin {
+	return p.hook(PluginPersistAfter, hookHandlerE(handler))
+}
+
+// OnReceive 注册收到消息的钩子（机器人类插件）
+func (p *Plugin) OnReceive(handler func(*Context)) *Plugin {
+	return p.hook(PluginReceive, handler)
+}
+
+// OnReceiveE 注册返回错误的收到消息钩子
+func (p *Plugin) OnReceiveE(handler func(*Context) error) *Plugin {
+	return p.hook(PluginReceive, hookHandlerE(handler))
+}
+
+func (p *Plugin) hook(method PluginMethod, handler func(*Context)) *Plugin {
+	if handler == nil {
+		delete(p.hooks, method)
+		return p
+	}
+	p.hooks[method] = handler
+	return p
+}
+
+// Routes 注册http路由
+func (p *Plugin) Routes(routes func(*Route)) *Plugin {
+	p.routes = routes
+	return p
+}
+
+// OnSetup 注册插件第一次连接上服务端后的回调
+func (p *Plugin) OnSetup(setup func()) *Plugin {
+	p.setup = setup
+	return p
+}
+
+// OnStop 注册插件停止时的回调
+func (p *Plugin) OnStop(stop func()) *Plugin {
+	p.stop = stop
+	return p
+}
+
+// OnHost 注册获取服务端接口的回调，插件启动时调用
+func (p *Plugin) OnHost(host func(HostAPI)) *Plugin {
+	p.host = host
+	return p
+}
+
+// WithConfig 设置插件的配置类型，通过 TypedConfig 创建
+func (p *Plugin) WithConfig(config ConfigBinding) *Plugin {
+	p.config = &config
+	return p
+}
+
+// Run 运行插件，直到服务端请求停止或收到退出信号
+func (p *Plugin) Run(opt ...Option) error {
+	return runServer(p, opt...)
+}
+
+// ConfigBinding 插件的配置类型和配置变更的回调
+type ConfigBinding struct {
+	typ      reflect.Type
+	onUpdate func(old, new reflect.Value)
+}
+
+// TypedConfig 声明插件的配置类型 T（结构体），配置的字段和标签规则与 Config 字段相同
+//
+// onUpdate 在配置变更后调用，old 为变更前的配置（第一次为零值），可以为nil。
+func TypedConfig[T any](onUpdate func(old, new T)) ConfigBinding {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("config type must be a struct, got %v", typ))
+	}
+	binding := ConfigBinding{
+		typ: typ,
+	}
+	if onUpdate != nil {
+		binding.onUpdate = func(old, new reflect.Value) {
+			onUpdate(old.Interface().(T), new.Interface().(T))
+		}
+	}
+	return binding
+}
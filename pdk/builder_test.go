@@ -0,0 +1,121 @@
+package pdk_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func newRunningHost(t *testing.T) *pdktest.Host {
+	t.Helper()
+	host, err := pdktest.NewHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(host.Close)
+	return host
+}
+
+func TestHookErrorsReturnedToHost(t *testing.T) {
+	host := newRunningHost(t)
+	p := pdk.New("wk.plugin.errors").
+		OnSendE(func(c *pdk.Context) error {
+			return errors.New("send rejected")
+		}).
+		OnReceiveE(func(c *pdk.Context) error {
+			return errors.New("receive failed")
+		}).
+		OnPersistAfterE(func(c *pdk.Context) error {
+			return errors.New("index failed")
+		})
+	if err := host.Run(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1}); err == nil || !strings.Contains(err.Error(), "send rejected") {
+		t.Fatalf("send: %v", err)
+	}
+	if err := host.Receive(&pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "bot", ChannelType: 1}); err == nil || !strings.Contains(err.Error(), "receive failed") {
+		t.Fatalf("receive: %v", err)
+	}
+	if err := host.PersistAfter(&pluginproto.Message{MessageId: 1}); err == nil || !strings.Contains(err.Error(), "index failed") {
+		t.Fatalf("persist after: %v", err)
+	}
+}
+
+type indexPlugin struct {
+	indexed []int64
+}
+
+func (p *indexPlugin) PersistAfterE(c *pdk.Context) error {
+	for _, m := range c.Messages {
+		if m.MessageId < 0 {
+			return errors.New("invalid message id")
+		}
+		p.indexed = append(p.indexed, m.MessageId)
+	}
+	return nil
+}
+
+func TestInstanceHookErrorReturnedToHost(t *testing.T) {
+	host := newRunningHost(t)
+	instance := &indexPlugin{}
+	if err := host.RunPlugin(func() interface{} { return instance }, "wk.plugin.index"); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.PersistAfter(&pluginproto.Message{MessageId: 1}, &pluginproto.Message{MessageId: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.PersistAfter(&pluginproto.Message{MessageId: -1}); err == nil || !strings.Contains(err.Error(), "invalid message id") {
+		t.Fatalf("persist after: %v", err)
+	}
+	if len(instance.indexed) != 2 {
+		t.Fatalf("indexed: %v", instance.indexed)
+	}
+}
+
+func TestBuilderMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugin  *pdk.Plugin
+		opt     []pdk.Option
+		methods []string
+	}{
+		{
+			name:    "hooks and routes",
+			plugin:  pdk.New("wk.plugin.builder").OnSend(func(c *pdk.Context) {}).OnReceiveE(func(c *pdk.Context) error { return nil }).Routes(func(r *pdk.Route) {}),
+			methods: []string{"Send", "Receive", "Route"},
+		},
+		{
+			name:    "nil removes hook",
+			plugin:  pdk.New("wk.plugin.builder").OnSend(func(c *pdk.Context) {}).OnPersistAfter(func(c *pdk.Context) {}).OnSend(nil),
+			methods: []string{"PersistAfter"},
+		},
+		{
+			name:    "module hooks",
+			plugin:  pdk.New("wk.plugin.builder"),
+			opt:     []pdk.Option{pdk.WithModules(pdk.NewModule("audit").OnPersistAfter(func(c *pdk.Context) {}))},
+			methods: []string{"PersistAfter"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := newRunningHost(t)
+			if err := host.Run(tt.plugin, tt.opt...); err != nil {
+				t.Fatal(err)
+			}
+			info := host.PluginInfo()
+			if info.No != "wk.plugin.builder" {
+				t.Fatalf("no: %s", info.No)
+			}
+			if !slices.Equal(info.Methods, tt.methods) {
+				t.Fatalf("methods: got %v, want %v", info.Methods, tt.methods)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package pdk
+
+import (
+	"errors"
+
+	wkproto "github.com/WuKongIM/WuKongIMGoProto"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// Channel 消息的目标频道
+type Channel struct {
+	ChannelId   string
+	ChannelType uint32
+}
+
+// PersonChannel 单聊频道，uid 为接收消息的用户
+func PersonChannel(uid string) Channel {
+	return Channel{ChannelId: uid, ChannelType: uint32(wkproto.ChannelTypePerson)}
+}
+
+// GroupChannel 群聊频道
+func GroupChannel(groupNo string) Channel {
+	return Channel{ChannelId: groupNo, ChannelType: uint32(wkproto.ChannelTypeGroup)}
+}
+
+// ReplyChannel 回复收到的消息时的目标频道：单聊回复给发送者，其他频道回复到原频道
+func ReplyChannel(recvPacket *pluginproto.RecvPacket) Channel {
+	if recvPacket.ChannelType == uint32(wkproto.ChannelTypePerson) {
+		return PersonChannel(recvPacket.FromUid)
+	}
+	return Channel{ChannelId: recvPacket.ChannelId, ChannelType: recvPacket.ChannelType}
+}
+
+func (c Channel) check() error {
+	if c.ChannelId == "" {
+		return errors.New("channelId is empty")
+	}
+	if c.ChannelType == 0 {
+		return errors.New("channelType is empty")
+	}
+	return nil
+}
+
+// SendPayload 以 fromUid 的身份向频道发送消息，payload 为编码后的消息内容
+//
+// 与 Context.Reply 不同，不需要收到消息，可以在路由、定时任务等地方主动发送消息。
+func SendPayload(host HostAPI, channel Channel, fromUid string, payload []byte, opt ...ReplyOption) (*pluginproto.SendResp, error) {
+	if err := channel.check(); err != nil {
+		return nil, err
+	}
+	if fromUid == "" {
+		return nil, errors.New("fromUid is empty")
+	}
+	opts := &ReplyOptions{}
+	for _, o := range opt {
+		o(opts)
+	}
+	return host.RequestSend(&pluginproto.SendReq{
+		Header:      opts.Header,
+		ClientMsgNo: opts.ClientMsgNo,
+		FromUid:     fromUid,
+		ChannelId:   channel.ChannelId,
+		ChannelType: channel.ChannelType,
+		Payload:     payload,
+	})
+}
+
+// SendText 以 fromUid 的身份向频道发送文本消息，见 SendPayload
+func SendText(host HostAPI, channel Channel, fromUid string, text string, opt ...ReplyOption) (*pluginproto.SendResp, error) {
+	payload, err := (&PayloadText{Type: 1, Content: text}).Encode()
+	if err != nil {
+		return nil, err
+	}
+	return SendPayload(host, channel, fromUid, payload, opt...)
+}
+
+// OpenStream 以 fromUid 的身份在频道中打开流
+//
+// 与 Context.OpenStream 不同，不需要收到消息，可以在路由、定时任务等地方主动推送流式消息。
+// host 为插件的 Server 时，流记录在 Server.ActiveStreams 中，插件停止时自动关闭。
+func OpenStream(host HostAPI, channel Channel, fromUid string, opt ...StreamOption) (*Stream, error) {
+	if err := channel.check(); err != nil {
+		return nil, err
+	}
+	if fromUid == "" {
+		return nil, errors.New("fromUid is empty")
+	}
+	opts := newStreamOptions()
+	server, _ := host.(*Server)
+	if server != nil {
+		opts.IdleTimeout = server.opts.StreamIdleTimeout
+		opts.MaxLifetime = server.opts.StreamMaxLifetime
+	}
+	for _, o := range opt {
+		o(opts)
+	}
+	streamInfo := &pluginproto.Stream{
+		Header:      opts.Header,
+		ClientMsgNo: opts.ClientMsgNo,
+		FromUid:     fromUid,
+		ChannelId:   channel.ChannelId,
+		ChannelType: channel.ChannelType,
+		Payload:     opts.Payload,
+	}
+	for _, fn := range opts.infoFuncs {
+		fn(streamInfo)
+	}
+	resp, err := host.RequestStreamOpen(streamInfo)
+	if err != nil {
+		return nil, err
+	}
+	stream := newStream(resp.StreamNo, streamInfo, host, opts)
+	if server != nil {
+		server.streams.track(stream)
+	}
+	stream.watch()
+	return stream, nil
+}
+
+// OpenStream 以 fromUid 的身份在频道中打开流，见 pdk.OpenStream
+func (s *Server) OpenStream(channel Channel, fromUid string, opt ...StreamOption) (*Stream, error) {
+	return OpenStream(s, channel, fromUid, opt...)
+}
+
+// SendText 以 fromUid 的身份向频道发送文本消息，见 pdk.SendText
+func (s *Server) SendText(channel Channel, fromUid string, text string, opt ...ReplyOption) (*pluginproto.SendResp, error) {
+	return SendText(s, channel, fromUid, text, opt...)
+}
+
+// SendPayload 以 fromUid 的身份向频道发送消息，见 pdk.SendPayload
+func (s *Server) SendPayload(channel Channel, fromUid string, payload []byte, opt ...ReplyOption) (*pluginproto.SendResp, error) {
+	return SendPayload(s, channel, fromUid, payload, opt...)
+}
@@ -0,0 +1,125 @@
+package pdk_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func TestSendPayloadChannel(t *testing.T) {
+	tests := []struct {
+		name        string
+		channel     pdk.Channel
+		fromUid     string
+		channelId   string
+		channelType uint32
+		wantErr     bool
+	}{
+		{name: "person", channel: pdk.PersonChannel("u2"), fromUid: "bot", channelId: "u2", channelType: 1},
+		{name: "group", channel: pdk.GroupChannel("g1"), fromUid: "bot", channelId: "g1", channelType: 2},
+		{name: "custom", channel: pdk.Channel{ChannelId: "c1", ChannelType: 10}, fromUid: "bot", channelId: "c1", channelType: 10},
+		{name: "empty channel id", channel: pdk.PersonChannel(""), fromUid: "bot", wantErr: true},
+		{name: "empty channel type", channel: pdk.Channel{ChannelId: "c1"}, fromUid: "bot", wantErr: true},
+		{name: "empty from uid", channel: pdk.GroupChannel("g1"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := pdktest.NewFakeHost()
+			_, err := pdk.SendPayload(host, tt.channel, tt.fromUid, []byte("hi"), pdk.ReplyWithClientMsgNo("no1"))
+			messages := host.SentMessages()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if len(messages) != 0 {
+					t.Fatalf("sent messages: %v", messages)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(messages) != 1 {
+				t.Fatalf("sent messages: %v", messages)
+			}
+			m := messages[0]
+			if m.ChannelId != tt.channelId || m.ChannelType != tt.channelType || m.FromUid != tt.fromUid || m.ClientMsgNo != "no1" || string(m.Payload) != "hi" {
+				t.Fatalf("sent message: %v", m)
+			}
+		})
+	}
+}
+
+func TestReplyChannel(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet *pluginproto.RecvPacket
+		want   pdk.Channel
+	}{
+		{
+			name:   "person replies to sender",
+			packet: &pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "bot", ChannelType: 1},
+			want:   pdk.PersonChannel("u1"),
+		},
+		{
+			name:   "group replies to group",
+			packet: &pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "g1", ChannelType: 2},
+			want:   pdk.GroupChannel("g1"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdk.ReplyChannel(tt.packet); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerSendFromRoute(t *testing.T) {
+	host := newRunningHost(t)
+	p := pdk.New("wk.plugin.notify").Routes(func(r *pdk.Route) {
+		r.POST("/notify/:uid", func(c *pdk.HttpContext) {
+			s := c.Host().(*pdk.Server)
+			if _, err := s.SendText(pdk.PersonChannel(c.Param("uid")), "notifier", "hello"); err != nil {
+				c.String(http.StatusInternalServerError, "%s", err)
+				return
+			}
+			stream, err := s.OpenStream(pdk.GroupChannel("g1"), "notifier")
+			if err != nil {
+				c.String(http.StatusInternalServerError, "%s", err)
+				return
+			}
+			if err := stream.Close(); err != nil {
+				c.String(http.StatusInternalServerError, "%s", err)
+				return
+			}
+			c.String(http.StatusOK, "ok")
+		})
+	})
+	if err := host.Run(p); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodPost, Path: "/notify/u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Fatalf("route: %d %s", resp.Status, resp.Body)
+	}
+
+	messages := host.SentMessages()
+	if len(messages) != 1 || messages[0].ChannelId != "u2" || messages[0].ChannelType != 1 || messages[0].FromUid != "notifier" {
+		t.Fatalf("sent messages: %v", messages)
+	}
+	streams := host.OpenedStreams()
+	if len(streams) != 1 || streams[0].ChannelId != "g1" || streams[0].ChannelType != 2 || streams[0].FromUid != "notifier" {
+		t.Fatalf("opened streams: %v", streams)
+	}
+	if len(host.ClosedStreams()) != 1 {
+		t.Fatalf("closed streams: %v", host.ClosedStreams())
+	}
+}
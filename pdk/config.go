@@ -0,0 +1,198 @@
+package pdk
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// 配置字段的类型
+const (
+	FieldTypeString = "string"
+	FieldTypeNumber = "number"
+	FieldTypeBool   = "bool"
+	FieldTypeSecret = "secret"
+	FieldTypeObject = "object" // 嵌套的结构体，子字段见 Field.Fields
+	FieldTypeArray  = "array"  // 切片，元素见 Field.Elem
+	FieldTypeMap    = "map"    // key为string的map，值见 Field.Elem
+)
+
+// number类型字段的格式
+const (
+	FieldFormatInteger  = "integer"  // 整数
+	FieldFormatDuration = "duration" // time.Duration，整数纳秒或 "3s" 这样的字符串
+)
+
+var secretKeyType = reflect.TypeOf(SecretKey(""))
+
+// configFieldName 配置字段的名字，取json标签（去掉omitempty等选项），未设置时使用字段名，"-" 表示忽略该字段
+func configFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// isEmbeddedStruct 是否是需要展开的匿名结构体（未设置json标签）
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); !field.Anonymous || name != "" {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func getFields(t reflect.Type) []*pluginproto.Field {
+	return getStructFields(t, map[reflect.Type]bool{})
+}
+
+// getStructFields 生成结构体的字段描述，visiting 为正在生成的结构体类型，用于跳过递归引用自身的字段
+func getStructFields(t reflect.Type, visiting map[reflect.Type]bool) []*pluginproto.Field {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	fields := []*pluginproto.Field{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// 匿名结构体的字段展开到当前层级
+		if isEmbeddedStruct(field) {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if !visiting[ft] {
+				fields = append(fields, getStructFields(ft, visiting)...)
+			}
+			continue
+		}
+		// ignore unexported fields
+		if len(field.PkgPath) != 0 {
+			continue
+		}
+
+		name := configFieldName(field)
+		if name == "-" {
+			continue
+		}
+		label := field.Tag.Get("label")
+		f := getField(field.Type, visiting)
+		if f == nil {
+			continue
+		}
+
+		if label == "" {
+			label = name
+		}
+		f.Name = name
+		f.Label = label
+		setFieldMeta(f, field)
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// setFieldMeta 将字段标签中的元数据写入字段描述
+//
+//	desc:"说明"  default:"10"  required:"true"  options:"a,b,c"  min:"1"  max:"100"  placeholder:"提示"
+//
+// 格式错误的 required、min、max 标签会被忽略。
+func setFieldMeta(f *pluginproto.Field, field reflect.StructField) {
+	f.Desc = field.Tag.Get("desc")
+	f.DefaultValue = field.Tag.Get("default")
+	f.Placeholder = field.Tag.Get("placeholder")
+	if required, err := strconv.ParseBool(field.Tag.Get("required")); err == nil {
+		f.Required = required
+	}
+	if options := field.Tag.Get("options"); options != "" {
+		for _, o := range strings.Split(options, ",") {
+			f.Options = append(f.Options, strings.TrimSpace(o))
+		}
+	}
+	if min, err := strconv.ParseFloat(field.Tag.Get("min"), 64); err == nil {
+		f.Min = &min
+	}
+	if max, err := strconv.ParseFloat(field.Tag.Get("max"), 64); err == nil {
+		f.Max = &max
+	}
+}
+
+// getField 根据类型生成字段描述，不支持的类型返回nil
+func getField(t reflect.Type, visiting map[reflect.Type]bool) *pluginproto.Field {
+	if t.Kind() == reflect.Ptr {
+		return getField(t.Elem(), visiting)
+	}
+	if fieldType := getFieldType(t); fieldType != "" {
+		return &pluginproto.Field{Type: fieldType, Format: getFieldFormat(t)}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			return nil
+		}
+		return &pluginproto.Field{
+			Type:   FieldTypeObject,
+			Fields: getStructFields(t, visiting),
+		}
+	case reflect.Slice, reflect.Array:
+		elem := getField(t.Elem(), visiting)
+		if elem == nil {
+			return nil
+		}
+		return &pluginproto.Field{
+			Type: FieldTypeArray,
+			Elem: elem,
+		}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil
+		}
+		elem := getField(t.Elem(), visiting)
+		if elem == nil {
+			return nil
+		}
+		return &pluginproto.Field{
+			Type: FieldTypeMap,
+			Elem: elem,
+		}
+	}
+	return nil
+}
+
+// getFieldType 基础类型的字段类型，非基础类型返回空字符串
+func getFieldType(t reflect.Type) string {
+	if t == secretKeyType {
+		return FieldTypeSecret
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return FieldTypeString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return FieldTypeNumber
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return FieldTypeNumber
+	case reflect.Float32, reflect.Float64:
+		return FieldTypeNumber
+	case reflect.Bool:
+		return FieldTypeBool
+	}
+	return ""
+}
+
+// getFieldFormat number类型字段的格式，浮点数和其他类型返回空字符串
+func getFieldFormat(t reflect.Type) string {
+	if t == durationType {
+		return FieldFormatDuration
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return FieldFormatInteger
+	}
+	return ""
+}
@@ -0,0 +1,478 @@
+package pdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigError 配置无法应用，Errors 为每个字段的错误
+type ConfigError struct {
+	Errors FieldErrors
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config: " + e.Errors.Error()
+}
+
+// MarshalJSON 返回给服务端的格式：{"msg":"invalid config","errors":[{"field":"a","message":"..."}]}
+func (e *ConfigError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"msg":    "invalid config",
+		"errors": e.Errors,
+	})
+}
+
+// configValidator 配置类型可以实现的校验接口
+type configValidator interface {
+	Validate() error
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeConfig 解析json格式的配置，数字解析为 json.Number 以避免精度丢失
+func decodeConfig(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	var cfg map[string]interface{}
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// fillConfig 将 cfg map 类型的数据填充到 config 结构体中
+//
+// 支持嵌套的结构体、切片、key为string的map以及指针，cfg 为json解码后的数据。
+// cfg 中没有（或为null）的字段使用 default 标签的值。
+//
+// 解码是严格的：未知的字段、溢出、小数赋值给整数、字符串赋值给数字或布尔值等都会报错，规则与 ConfigSchema 一致；
+// 填充后按 required、options、min、max 标签校验，最后调用配置的 Validate 方法（如果有）。
+// 所有字段的错误会一起通过 *ConfigError 返回。
+//
+// strict 为false时忽略未知的字段并通过 ignored 返回，用于启动时应用服务端保存的配置
+// （插件升级后删除或重命名了字段，旧的配置中仍然有这些字段）。
+func fillConfig(cfg map[string]interface{}, config interface{}, strict bool) (ignored []string, err error) {
+	d := &configDecoder{ignoreUnknown: !strict}
+	d.fillStruct(reflect.ValueOf(config).Elem(), cfg, "")
+	if len(d.errs) == 0 {
+		if validator, ok := config.(configValidator); ok {
+			d.addValidateError(validator.Validate())
+		}
+	}
+	if len(d.errs) > 0 {
+		return d.ignored, &ConfigError{Errors: d.errs}
+	}
+	return d.ignored, nil
+}
+
+type configDecoder struct {
+	errs          FieldErrors
+	ignoreUnknown bool     // 忽略未知的字段
+	ignored       []string // 忽略的未知字段
+}
+
+func (d *configDecoder) fail(path string, format string, args ...interface{}) {
+	d.errs = append(d.errs, &FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *configDecoder) addValidateError(err error) {
+	if err == nil {
+		return
+	}
+	var fieldErrs FieldErrors
+	var fieldErr *FieldError
+	switch {
+	case errors.As(err, &fieldErrs):
+		d.errs = append(d.errs, fieldErrs...)
+	case errors.As(err, &fieldErr):
+		d.errs = append(d.errs, fieldErr)
+	default:
+		d.errs = append(d.errs, &FieldError{Message: err.Error()})
+	}
+}
+
+func (d *configDecoder) fillStruct(v reflect.Value, cfg map[string]interface{}, prefix string) {
+	known := map[string]bool{}
+	d.fillFields(v, cfg, prefix, known)
+
+	// 未知的字段
+	var unknown []string
+	for key := range cfg {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		if d.ignoreUnknown {
+			d.ignored = append(d.ignored, prefix+key)
+			continue
+		}
+		d.fail(prefix+key, "unknown field")
+	}
+}
+
+func (d *configDecoder) fillFields(v reflect.Value, cfg map[string]interface{}, prefix string, known map[string]bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldValue := v.Field(i)
+		if isEmbeddedStruct(field) {
+			if field.Type.Kind() == reflect.Ptr {
+				if !fieldValue.CanSet() {
+					continue
+				}
+				if fieldValue.IsNil() {
+					fieldValue.Set(reflect.New(field.Type.Elem()))
+				}
+				fieldValue = fieldValue.Elem()
+			}
+			d.fillFields(fieldValue, cfg, prefix, known)
+			continue
+		}
+		if !fieldValue.CanSet() {
+			continue
+		}
+		name := configFieldName(field)
+		if name == "-" {
+			continue
+		}
+		known[name] = true
+		path := prefix + name
+
+		value, exists := cfg[name]
+		switch {
+		case value != nil:
+			d.setValue(fieldValue, value, path)
+		case field.Tag.Get("default") != "":
+			d.setDefault(fieldValue, field.Tag.Get("default"), path)
+		case exists:
+			fieldValue.Set(reflect.Zero(fieldValue.Type()))
+		case fieldValue.Kind() == reflect.Struct:
+			// 未配置的嵌套结构体也需要填充默认值
+			d.fillStruct(fieldValue, nil, path+".")
+		}
+		d.checkRules(fieldValue, field, path)
+	}
+}
+
+// setDefault 将 default 标签的值赋给配置字段
+//
+// 结构体、map以及以 [ 开头的切片默认值按json解析，其他切片按逗号分隔。
+func (d *configDecoder) setDefault(v reflect.Value, def string, path string) {
+	t := v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	kind := t.Kind()
+	isList := kind == reflect.Slice || kind == reflect.Array
+	if kind == reflect.Struct || kind == reflect.Map || isList && strings.HasPrefix(strings.TrimSpace(def), "[") {
+		value, err := decodeConfigValue(def)
+		if err != nil {
+			d.fail(path, "invalid default %q: %v", def, err)
+			return
+		}
+		d.setValue(v, value, path)
+		return
+	}
+	if !isList {
+		d.setValue(v, stringValue(getFieldType(t), def), path)
+		return
+	}
+	elemType := t.Elem()
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	items := []interface{}{}
+	for _, s := range strings.FieldsFunc(def, func(r rune) bool { return r == ',' }) {
+		items = append(items, stringValue(getFieldType(elemType), strings.TrimSpace(s)))
+	}
+	d.setValue(v, items, path)
+}
+
+// stringValue 将标签或环境变量中的字符串按字段类型转换为数字（json.Number）或布尔值，无法转换时返回原字符串，由解码报错
+func stringValue(fieldType string, s string) interface{} {
+	trimmed := strings.TrimSpace(s)
+	switch fieldType {
+	case FieldTypeNumber:
+		if _, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return json.Number(trimmed)
+		}
+	case FieldTypeBool:
+		if b, err := strconv.ParseBool(trimmed); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+func decodeConfigValue(data string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// setValue 将json解码后的值赋给配置字段，path 用于错误信息
+func (d *configDecoder) setValue(v reflect.Value, value interface{}, path string) {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		n := len(d.errs)
+		d.setValue(elem.Elem(), value, path)
+		if len(d.errs) == n {
+			v.Set(elem)
+		}
+	case reflect.Interface:
+		val := reflect.ValueOf(plainValue(value))
+		if !val.Type().AssignableTo(v.Type()) {
+			d.fail(path, "cannot convert %s to %v", jsonKind(value), v.Type())
+			return
+		}
+		v.Set(val)
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			d.fail(path, "cannot convert %s to object", jsonKind(value))
+			return
+		}
+		d.fillStruct(v, m, path+".")
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			d.fail(path, "cannot convert %s to array", jsonKind(value))
+			return
+		}
+		if v.Kind() == reflect.Array {
+			if len(items) > v.Len() {
+				d.fail(path, "too many items, max %d", v.Len())
+				return
+			}
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), len(items), len(items)))
+		}
+		for i, item := range items {
+			d.setValue(v.Index(i), item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			d.fail(path, "cannot convert %s to %v", jsonKind(value), v.Type())
+			return
+		}
+		result := reflect.MakeMapWithSize(v.Type(), len(m))
+		for key, item := range m {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			d.setValue(elem, item, path+"."+key)
+			result.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		v.Set(result)
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			d.fail(path, "cannot convert %s to string", jsonKind(value))
+			return
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			d.fail(path, "cannot convert %s to bool", jsonKind(value))
+			return
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		d.setNumber(v, value, path)
+	default:
+		d.fail(path, "unsupported type %v", v.Type())
+	}
+}
+
+// setNumber 严格地将数字赋给数字类型的字段，不会截断小数或溢出，time.Duration 还支持 "3s" 这样的字符串
+func (d *configDecoder) setNumber(v reflect.Value, value interface{}, path string) {
+	var s string
+	switch n := value.(type) {
+	case json.Number:
+		s = n.String()
+	case string:
+		if v.Type() != durationType {
+			d.fail(path, "cannot convert string to %v", v.Type())
+			return
+		}
+		dur, err := time.ParseDuration(strings.TrimSpace(n))
+		if err != nil {
+			d.fail(path, "cannot convert %q to %v", n, v.Type())
+			return
+		}
+		v.SetInt(int64(dur))
+		return
+	case float64:
+		s = strconv.FormatFloat(n, 'f', -1, 64)
+	case float32:
+		s = strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s = fmt.Sprint(n)
+	default:
+		d.fail(path, "cannot convert %s to %v", jsonKind(value), v.Type())
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(integerString(s), 10, v.Type().Bits())
+		if err != nil {
+			d.numberError(v, s, err, path)
+			return
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(integerString(s), 10, v.Type().Bits())
+		if err != nil {
+			d.numberError(v, s, err, path)
+			return
+		}
+		v.SetUint(n)
+	default:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			d.numberError(v, s, err, path)
+			return
+		}
+		v.SetFloat(n)
+	}
+}
+
+// integerString 将小数部分为0的数字（例如 1.0、1e3）转换为整数的写法，与JSON Schema的 integer 一致，其他数字原样返回
+func integerString(s string) string {
+	// 超出范围的数字不需要转换，也避免解析很大的指数
+	if f, err := strconv.ParseFloat(s, 64); err != nil || math.Abs(f) > math.MaxUint64 {
+		return s
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || !r.IsInt() {
+		return s
+	}
+	return r.Num().String()
+}
+
+func (d *configDecoder) numberError(v reflect.Value, s string, err error, path string) {
+	if errors.Is(err, strconv.ErrRange) {
+		d.fail(path, "value %s overflows %v", s, v.Type())
+		return
+	}
+	d.fail(path, "cannot convert %q to %v", s, v.Type())
+}
+
+// checkRules 按 required、options、min、max 标签校验字段的值
+func (d *configDecoder) checkRules(v reflect.Value, field reflect.StructField, path string) {
+	if required, _ := strconv.ParseBool(field.Tag.Get("required")); required && v.IsZero() {
+		d.fail(path, "is required")
+		return
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if options := field.Tag.Get("options"); options != "" {
+		allowed := strings.Split(options, ",")
+		for i := range allowed {
+			allowed[i] = strings.TrimSpace(allowed[i])
+		}
+		values := []reflect.Value{v}
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			values = values[:0]
+			for i := 0; i < v.Len(); i++ {
+				values = append(values, v.Index(i))
+			}
+		}
+		for _, item := range values {
+			// 未设置的值由 required 校验
+			if item.IsZero() {
+				continue
+			}
+			if !contains(allowed, fmt.Sprint(item.Interface())) {
+				d.fail(path, "must be one of [%s]", strings.Join(allowed, ", "))
+				return
+			}
+		}
+	}
+
+	n, isLen, ok := measure(v)
+	if !ok {
+		return
+	}
+	what := "value"
+	if isLen {
+		what = "length"
+	}
+	if min, err := strconv.ParseFloat(field.Tag.Get("min"), 64); err == nil && n < min {
+		d.fail(path, "%s must be at least %s", what, field.Tag.Get("min"))
+		return
+	}
+	if max, err := strconv.ParseFloat(field.Tag.Get("max"), 64); err == nil && n > max {
+		d.fail(path, "%s must be at most %s", what, field.Tag.Get("max"))
+	}
+}
+
+// plainValue 将 json.Number 转换为float64，与 encoding/json 解码到 interface{} 的结果一致
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = plainValue(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = plainValue(item)
+		}
+		return items
+	}
+	return value
+}
+
+// jsonKind 错误信息中json值的类型
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case json.Number, float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
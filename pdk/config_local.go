@@ -0,0 +1,240 @@
+package pdk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigEnvPrefix 本地配置环境变量的前缀
+//
+// 嵌套的字段用 __ 分隔，字段名不区分大小写，例如：
+//
+//	PDK_CONFIG_API_KEY=xxx               -> {"api_key": "xxx"}
+//	PDK_CONFIG_LIMITS__PER_MINUTE=10     -> {"limits": {"per_minute": 10}}
+//	PDK_CONFIG_KEYWORDS=a,b              -> {"keywords": ["a", "b"]}
+const ConfigEnvPrefix = "PDK_CONFIG_"
+
+// localConfigFiles 沙箱目录中按顺序查找的本地配置文件
+var localConfigFiles = []string{"config.yaml", "config.yml", "config.json"}
+
+// applyConfig 合并本地配置和服务端的配置后应用，host 为nil表示服务端没有下发配置，此时应用各字段的默认值
+//
+// 优先级：配置文件 < 环境变量 < 服务端配置，对象类型的配置按字段合并。
+// strict 为false时忽略未知的字段，见 fillConfig。
+func (p *plugin) applyConfig(host map[string]interface{}, strict bool) error {
+	cfg := host
+	if p.opts.LocalConfig {
+		local, err := p.loadLocalConfig()
+		if err != nil {
+			p.Warn("load local config error", zap.Error(err))
+		} else {
+			cfg = mergeConfig(local, host)
+		}
+	}
+	if cfg == nil {
+		// 没有任何配置时也需要解码，使用 default 标签的默认值生成第一个配置快照
+		cfg = map[string]interface{}{}
+	}
+	return p.configUpdate(cfg, strict)
+}
+
+// loadInitialConfig 启动时应用本地配置，连接WuKongIM后会与服务端的配置合并后重新应用
+func (p *plugin) loadInitialConfig() {
+	var updateErr error
+	err := p.safeCall(PluginConfigUpdate, nil, func() {
+		updateErr = p.applyConfig(nil, false)
+	})
+	if err == nil {
+		err = updateErr
+	}
+	if err != nil {
+		p.Warn("apply local config error", zap.Error(err))
+	}
+}
+
+// loadLocalConfig 读取本地配置文件和环境变量
+func (p *plugin) loadLocalConfig() (map[string]interface{}, error) {
+	cfg, err := p.readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	var fields []*pluginproto.Field
+	if p.cfgTemplate != nil {
+		fields = p.cfgTemplate.Fields
+	}
+	return mergeConfig(cfg, configFromEnv(os.Environ(), fields)), nil
+}
+
+// readConfigFile 读取配置文件，指定了 Options.ConfigFile 时只读取该文件，否则在沙箱目录中查找
+func (p *plugin) readConfigFile() (map[string]interface{}, error) {
+	file := p.opts.ConfigFile
+	if file == "" {
+		if p.sandbox == "" {
+			return nil, nil
+		}
+		for _, name := range localConfigFiles {
+			if _, err := os.Stat(filepath.Join(p.sandbox, name)); err == nil {
+				file = filepath.Join(p.sandbox, name)
+				break
+			}
+		}
+		if file == "" {
+			return nil, nil
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfigFile(file, data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s error: %w", file, err)
+	}
+	return cfg, nil
+}
+
+// parseConfigFile 根据扩展名解析json或yaml格式的配置文件
+func parseConfigFile(file string, data []byte) (map[string]interface{}, error) {
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		return decodeConfig(data)
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	cfg, ok := yamlValue(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config must be an object")
+	}
+	return cfg, nil
+}
+
+// yamlValue 将yaml解析的 map[interface{}]interface{} 转换为json格式的 map[string]interface{}
+func yamlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = yamlValue(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = yamlValue(item)
+		}
+		return items
+	}
+	return value
+}
+
+// configFromEnv 从 PDK_CONFIG_ 开头的环境变量中读取配置，fields 用于匹配字段名和按字段类型转换值
+func configFromEnv(environ []string, fields []*pluginproto.Field) map[string]interface{} {
+	var cfg map[string]interface{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, ConfigEnvPrefix) || len(key) == len(ConfigEnvPrefix) {
+			continue
+		}
+		if cfg == nil {
+			cfg = map[string]interface{}{}
+		}
+		setEnvValue(cfg, strings.Split(key[len(ConfigEnvPrefix):], "__"), value, fields, nil)
+	}
+	return cfg
+}
+
+// setEnvValue 按路径将环境变量的值写入配置，fields 为当前层级的字段，elem 为当前层级是map时的元素
+func setEnvValue(cfg map[string]interface{}, path []string, value string, fields []*pluginproto.Field, elem *pluginproto.Field) {
+	name := path[0]
+	field := elem
+	if elem == nil {
+		name = strings.ToLower(name)
+		field = nil
+		for _, f := range fields {
+			if strings.EqualFold(f.Name, path[0]) {
+				name = f.Name
+				field = f
+				break
+			}
+		}
+	}
+
+	if len(path) == 1 {
+		cfg[name] = envValue(field, value)
+		return
+	}
+	child, ok := cfg[name].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		cfg[name] = child
+	}
+	var childFields []*pluginproto.Field
+	var childElem *pluginproto.Field
+	if field != nil {
+		if field.Type == FieldTypeMap {
+			childElem = field.Elem
+		} else {
+			childFields = field.Fields
+		}
+	}
+	setEnvValue(child, path[1:], value, childFields, childElem)
+}
+
+// envValue 转换环境变量的值，数组按逗号分隔（或json），对象和map按json解析，数字和布尔值按字段类型转换
+func envValue(field *pluginproto.Field, value string) interface{} {
+	if field == nil {
+		return value
+	}
+	trimmed := strings.TrimSpace(value)
+	switch field.Type {
+	case FieldTypeArray:
+		if strings.HasPrefix(trimmed, "[") {
+			if v, err := decodeConfigValue(trimmed); err == nil {
+				return v
+			}
+		}
+		items := []interface{}{}
+		for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' }) {
+			items = append(items, envValue(field.Elem, strings.TrimSpace(item)))
+		}
+		return items
+	case FieldTypeObject, FieldTypeMap:
+		if v, err := decodeConfigValue(trimmed); err == nil {
+			return v
+		}
+	case FieldTypeNumber, FieldTypeBool:
+		return stringValue(field.Type, value)
+	}
+	return value
+}
+
+// mergeConfig 合并两份配置，src 中的值覆盖 dst，两边都是对象时按字段合并，结果为新的map
+func mergeConfig(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil && src == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		result[k] = v
+	}
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]interface{})
+		dstMap, dstOk := result[k].(map[string]interface{})
+		if srcOk && dstOk {
+			result[k] = mergeConfig(dstMap, srcMap)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package pdk
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Config 获取通过 RunServer 或 Plugin.Run 运行的插件当前配置的快照，T 为插件 Config 字段的类型
+//
+// 每次配置更新都会生成新的快照并原子地替换，已经获取的快照不会被修改，可以在钩子中并发读取。
+// 未收到配置或 T 与配置类型不一致时返回零值。
+// 插件没有配置类型为 T 的配置时，返回第一个配置类型为 T 的模块的配置。
+//
+// Config 读取全局的 S，只适用于进程中只有一个通过 RunServer 运行的插件，
+// 建议在处理函数中使用 pdk.ConfigFrom[T](c.Host()) 读取当前插件的配置。
+//
+//	cfg := pdk.Config[MyConfig]()
+func Config[T any]() T {
+	return ConfigFrom[T](S)
+}
+
+// ConfigFrom 获取指定服务的插件当前配置的快照，见 Config
+//
+// host 通常为 c.Host() 或 h.Host()，不依赖全局的 S，通过 pdk.Run 运行的插件需要使用它获取配置。
+// host 不是 *Server 时（例如测试中的假实现）返回零值。
+func ConfigFrom[T any](host HostAPI) T {
+	var empty T
+	s, ok := host.(*Server)
+	if !ok || s == nil || s.plugin == nil {
+		return empty
+	}
+	for _, slot := range s.plugin.configs {
+		if cfg, ok := snapshotAs[T](slot.load()); ok {
+			return cfg
+		}
+	}
+	return empty
+}
+
+// ModuleConfig 获取模块当前配置的快照，name 为模块名，与 Config 一样读取全局的 S，建议使用 ModuleConfigFrom
+func ModuleConfig[T any](name string) T {
+	return ModuleConfigFrom[T](S, name)
+}
+
+// ModuleConfigFrom 获取指定服务中模块当前配置的快照，见 ModuleConfig
+func ModuleConfigFrom[T any](host HostAPI, name string) T {
+	var empty T
+	s, ok := host.(*Server)
+	if !ok || s == nil || s.plugin == nil || name == "" {
+		return empty
+	}
+	for _, slot := range s.plugin.configs {
+		if slot.name == name {
+			cfg, _ := snapshotAs[T](slot.load())
+			return cfg
+		}
+	}
+	return empty
+}
+
+func snapshotAs[T any](snapshot interface{}) (T, bool) {
+	switch cfg := snapshot.(type) {
+	case *T:
+		return *cfg, true
+	case T:
+		return cfg, true
+	}
+	var empty T
+	return empty, false
+}
+
+// configSlot 插件自身（name为空）或某个模块的配置
+type configSlot struct {
+	name     string // 模块名，也是配置中的命名空间
+	typ      reflect.Type
+	onUpdate func(old, new reflect.Value)
+	value    atomic.Value // 当前配置的快照（指向配置结构体的指针）
+}
+
+// load 当前配置的快照，未收到配置时返回nil
+func (c *configSlot) load() interface{} {
+	return c.value.Load()
+}
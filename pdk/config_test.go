@@ -0,0 +1,142 @@
+package pdk
+
+import (
+	"testing"
+)
+
+func newTestPlugin(def *Plugin, opt ...Option) *plugin {
+	opts := newOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+	opts.No = def.no
+	return newPlugin(opts, def, nil)
+}
+
+func rootConfig[T any](t *testing.T, p *plugin) T {
+	t.Helper()
+	cfg, ok := snapshotAs[T](p.configs[0].load())
+	if !ok {
+		t.Fatal("config snapshot not found")
+	}
+	return cfg
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	type Config struct {
+		Limit int    `json:"limit" default:"5"`
+		Name  string `json:"name" default:"bot"`
+	}
+	tests := []struct {
+		name string
+		host map[string]interface{}
+		want Config
+	}{
+		{name: "no host config", host: nil, want: Config{Limit: 5, Name: "bot"}},
+		{name: "empty host config", host: map[string]interface{}{}, want: Config{Limit: 5, Name: "bot"}},
+		{name: "partial host config", host: map[string]interface{}{"limit": 9}, want: Config{Limit: 9, Name: "bot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlugin(New("wk.plugin.test").WithConfig(TypedConfig[Config](nil)))
+			if err := p.applyConfig(tt.host, true); err != nil {
+				t.Fatal(err)
+			}
+			if got := rootConfig[Config](t, p); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfigUnknownFields(t *testing.T) {
+	type Config struct {
+		Limit int `json:"limit"`
+	}
+	host := map[string]interface{}{"limit": 9, "removed_field": "x"}
+
+	// 更新配置时拒绝未知的字段，保留旧的配置
+	p := newTestPlugin(New("wk.plugin.test").WithConfig(TypedConfig[Config](nil)))
+	err := p.applyConfig(host, true)
+	cfgErr, ok := err.(*ConfigError)
+	if !ok || len(cfgErr.Errors) != 1 || cfgErr.Errors[0].Field != "removed_field" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 启动时忽略未知的字段
+	if err := p.applyConfig(host, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := rootConfig[Config](t, p); got.Limit != 9 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+type snapshotConfigPlugin struct {
+	Config struct {
+		Limit int `json:"limit"`
+	}
+}
+
+type legacyConfigPlugin struct {
+	Config struct {
+		Limit int `json:"limit"`
+	}
+	updates []int // ConfigUpdate 时读取到的 Config.Limit
+}
+
+func (p *legacyConfigPlugin) ConfigUpdate() {
+	p.updates = append(p.updates, p.Config.Limit)
+}
+
+// 模拟已调用 Setup
+func freezeConfig(p *plugin) {
+	p.configMu.Lock()
+	p.configFrozen = true
+	p.configMu.Unlock()
+}
+
+func TestConfigFieldWrittenBeforeSetupOnly(t *testing.T) {
+	instance := &snapshotConfigPlugin{}
+	p := newTestPlugin(NewFromInstance(instance, "wk.plugin.test"))
+
+	if err := p.applyConfig(map[string]interface{}{"limit": 1}, false); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Config.Limit != 1 {
+		t.Fatalf("config field before setup: %+v", instance.Config)
+	}
+
+	freezeConfig(p)
+	if err := p.applyConfig(map[string]interface{}{"limit": 2}, true); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Config.Limit != 1 {
+		t.Fatalf("config field is written after setup: %+v", instance.Config)
+	}
+	if got := rootConfig[struct {
+		Limit int `json:"limit"`
+	}](t, p); got.Limit != 2 {
+		t.Fatalf("config snapshot: %+v", got)
+	}
+}
+
+// 实现了 ConfigUpdate() 的插件在 Setup 之后仍然通过 Config 字段读取新的配置
+func TestLegacyConfigUpdateReadsConfigField(t *testing.T) {
+	instance := &legacyConfigPlugin{}
+	p := newTestPlugin(NewFromInstance(instance, "wk.plugin.test"))
+
+	if err := p.applyConfig(map[string]interface{}{"limit": 1}, false); err != nil {
+		t.Fatal(err)
+	}
+	freezeConfig(p)
+	if err := p.applyConfig(map[string]interface{}{"limit": 2}, true); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Config.Limit != 2 {
+		t.Fatalf("config field after setup: %+v", instance.Config)
+	}
+	if len(instance.updates) != 2 || instance.updates[0] != 1 || instance.updates[1] != 2 {
+		t.Fatalf("values seen by ConfigUpdate: %v", instance.updates)
+	}
+}
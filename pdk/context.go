@@ -1,11 +1,16 @@
 package pdk
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
 
-	wkproto "github.com/WuKongIM/WuKongIMGoProto"
 	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
 	"go.uber.org/zap"
 )
@@ -17,92 +22,223 @@ type Context struct {
 	Messages []*pluginproto.Message
 	// 接收包
 	RecvPacket *pluginproto.RecvPacket
-	s          *Server
+	host       HostAPI
+	ctx        context.Context // 请求的上下文，随请求结束或超时取消
+
+	Keys // 请求范围内的键值存储
+
+	method   PluginMethod  // 当前执行的钩子
+	handlers []HookHandler // 钩子的处理链
+	index    int           // 当前执行到的处理函数
+	err      error         // 处理链返回的错误
 }
 
-func newMessageContext(s *Server, messages []*pluginproto.Message) *Context {
+// 调用Abort后的index，大于任何处理链的长度
+const abortIndex = math.MaxInt32
+
+// NewMessageContext 创建PersistAfter的上下文
+func NewMessageContext(host HostAPI, messages []*pluginproto.Message) *Context {
 	return &Context{
-		s:        s,
+		host:     host,
 		Messages: messages,
+		index:    -1,
 	}
 }
 
-func newSendContext(s *Server, sendPacket *pluginproto.SendPacket) *Context {
+// NewSendContext 创建Send的上下文
+func NewSendContext(host HostAPI, sendPacket *pluginproto.SendPacket) *Context {
 	return &Context{
-		s:          s,
+		host:       host,
 		SendPacket: sendPacket,
+		index:      -1,
 	}
 }
 
-func newRecvContext(s *Server, recvPacket *pluginproto.RecvPacket) *Context {
+// NewRecvContext 创建Receive的上下文
+func NewRecvContext(host HostAPI, recvPacket *pluginproto.RecvPacket) *Context {
 	return &Context{
-		s:          s,
+		host:       host,
 		RecvPacket: recvPacket,
+		index:      -1,
 	}
 }
 
-// 打开流
-func (c *Context) OpenStream(opt ...StreamOption) (*Stream, error) {
+// Host 服务端接口
+func (c *Context) Host() HostAPI {
+	return c.host
+}
 
-	if c.RecvPacket == nil {
-		return nil, errors.New("RecvPacket is nil")
+// Context 请求的 context.Context，服务端的请求结束、超时或插件停止时会被取消
+//
+// 调用服务端接口或其他耗时操作时应使用该上下文。
+func (c *Context) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
 	}
+	return c.ctx
+}
 
-	channelId := c.RecvPacket.ChannelId
-	if c.RecvPacket.ChannelType == uint32(wkproto.ChannelTypePerson) {
-		channelId = c.RecvPacket.FromUid
-	}
-	streamInfo := &pluginproto.Stream{
-		FromUid:     c.RecvPacket.ToUid,
-		ChannelId:   channelId,
-		ChannelType: c.RecvPacket.ChannelType,
-	}
-	for _, o := range opt {
-		o(streamInfo)
-	}
-	resp, err := c.s.RequestStreamOpen(streamInfo)
-	if err != nil {
-		return nil, err
+// SetContext 替换请求的 context.Context，中间件可以用来附加值或缩短超时时间
+func (c *Context) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// Method 当前执行的钩子
+func (c *Context) Method() PluginMethod {
+	return c.method
+}
+
+// Next 执行处理链中后续的处理函数（只应在中间件中调用）
+func (c *Context) Next() {
+	c.index++
+	for c.index < len(c.handlers) {
+		c.handlers[c.index](c)
+		c.index++
 	}
+}
 
-	stream := newStream(resp.StreamNo, streamInfo, c.s)
+// Abort 阻止处理链中后续的处理函数执行，当前处理函数会继续执行完
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
 
-	return stream, nil
+// IsAborted 是否已经调用了Abort
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
 }
 
-// 回复消息
-func (c *Context) Reply(payload []byte, opt ...ReplyOption) {
+// AbortWithError 阻止后续的处理函数执行，并将错误返回给服务端
+func (c *Context) AbortWithError(err error) {
+	c.err = err
+	c.Abort()
+}
+
+// Err 处理链返回的错误
+func (c *Context) Err() error {
+	return c.err
+}
+
+// 执行钩子的处理链
+func (c *Context) run(method PluginMethod, handlers []HookHandler) {
+	c.method = method
+	c.handlers = handlers
+	c.index = -1
+	c.Next()
+}
+
+// 打开流，回复到收到消息的频道
+//
+// 开启 WithStreamBindRequest 时流在请求结束时自动关闭。
+func (c *Context) OpenStream(opt ...StreamOption) (*Stream, error) {
+
 	if c.RecvPacket == nil {
-		return
+		return nil, errors.New("RecvPacket is nil")
 	}
-
-	opts := &ReplyOptions{}
-	for _, o := range opt {
-		o(opts)
+	// 请求结束（处理函数返回、panic或超时）时自动关闭流
+	if s, ok := c.host.(*Server); ok && s.opts.StreamBindRequest {
+		opt = append([]StreamOption{StreamWithContext(c.Context())}, opt...)
 	}
+	return OpenStream(c.host, ReplyChannel(c.RecvPacket), c.RecvPacket.ToUid, opt...)
+}
 
-	channelId := c.RecvPacket.ChannelId
-	channelType := c.RecvPacket.ChannelType
-	if c.RecvPacket.ChannelType == uint32(wkproto.ChannelTypePerson) {
-		channelId = c.RecvPacket.FromUid
+// 回复消息
+func (c *Context) Reply(payload []byte, opt ...ReplyOption) {
+	if c.RecvPacket == nil {
+		return
 	}
 
-	_, err := c.s.RequestSend(&pluginproto.SendReq{
-		Header:      opts.Header,
-		ClientMsgNo: opts.ClientMsgNo,
-		FromUid:     c.RecvPacket.ToUid,
-		ChannelId:   channelId,
-		ChannelType: channelType,
-		Payload:     payload,
-	})
+	_, err := SendPayload(c.host, ReplyChannel(c.RecvPacket), c.RecvPacket.ToUid, payload, opt...)
 	if err != nil {
-		c.s.Error("Reply error", zap.Error(err))
+		hostLog(c.host, "Context").Error("Reply error", zap.Error(err))
 	}
 }
 
 type HttpContext struct {
 	Request  *pluginproto.HttpRequest
 	Response *pluginproto.HttpResponse
+	host     HostAPI
+	ctx      context.Context // 请求的上下文，随请求结束或超时取消
+
+	Keys // 请求范围内的键值存储
+
+	params   Params    // 路径参数
+	fullPath string    // 匹配到的路由
+	handlers []Handler // 路由的处理链（中间件 + 处理函数）
+	index    int       // 当前执行到的处理函数
+
+	form          url.Values      // 解析后的表单（urlencoded或multipart）
+	multipartForm *multipart.Form // 解析后的multipart表单
+}
+
+// NewHttpContext 创建http请求的上下文
+func NewHttpContext(host HostAPI, req *pluginproto.HttpRequest) *HttpContext {
+	return &HttpContext{
+		Request: req,
+		Response: &pluginproto.HttpResponse{
+			Headers: map[string]string{},
+		},
+		host:  host,
+		index: -1,
+	}
+}
+
+// Host 服务端接口
+func (h *HttpContext) Host() HostAPI {
+	return h.host
+}
+
+// Context 请求的 context.Context，服务端的请求结束、超时或插件停止时会被取消
+func (h *HttpContext) Context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
+// SetContext 替换请求的 context.Context，中间件可以用来附加值或缩短超时时间
+func (h *HttpContext) SetContext(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// Param 获取路径参数，例如路由 /messages/:channelId 中的 channelId
+func (h *HttpContext) Param(key string) string {
+	return h.params.ByName(key)
+}
+
+// Params 所有的路径参数
+func (h *HttpContext) Params() Params {
+	return h.params
+}
+
+// FullPath 匹配到的路由，例如 /messages/:channelId，未匹配时为空
+func (h *HttpContext) FullPath() string {
+	return h.fullPath
+}
+
+// Next 执行处理链中后续的处理函数（只应在中间件中调用）
+func (h *HttpContext) Next() {
+	h.index++
+	for h.index < len(h.handlers) {
+		h.handlers[h.index](h)
+		h.index++
+	}
+}
+
+// Abort 阻止处理链中后续的处理函数执行，当前处理函数会继续执行完
+func (h *HttpContext) Abort() {
+	h.index = abortIndex
+}
+
+// IsAborted 是否已经调用了Abort
+func (h *HttpContext) IsAborted() bool {
+	return h.index >= abortIndex
+}
+
+// 执行路由的处理链
+func (h *HttpContext) run(handlers []Handler) {
+	h.handlers = handlers
+	h.index = -1
+	h.Next()
 }
 
 func (h *HttpContext) GetQuery(key string) string {
@@ -120,11 +256,20 @@ func (h *HttpContext) BindJSON(v interface{}) error {
 	return json.Unmarshal(h.Request.Body, v)
 }
 
+// GetHeader 获取请求头，key不区分大小写
 func (h *HttpContext) GetHeader(key string) string {
 	if h.Request.Headers == nil {
 		return ""
 	}
-	return h.Request.Headers[key]
+	if v, ok := h.Request.Headers[key]; ok {
+		return v
+	}
+	for k, v := range h.Request.Headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
 }
 
 func (h *HttpContext) JSON(code int, v interface{}) {
@@ -134,6 +279,65 @@ func (h *HttpContext) JSON(code int, v interface{}) {
 	h.Response.Headers["Content-Type"] = "application/json"
 }
 
+// String 返回文本，format 和 values 的用法同 fmt.Sprintf
+func (h *HttpContext) String(code int, format string, values ...interface{}) {
+	body := format
+	if len(values) > 0 {
+		body = fmt.Sprintf(format, values...)
+	}
+	h.Data(code, "text/plain; charset=utf-8", []byte(body))
+}
+
+// Data 返回指定Content-Type的数据
+func (h *HttpContext) Data(code int, contentType string, data []byte) {
+	h.Response.Status = int32(code)
+	h.Response.Body = data
+	if contentType != "" {
+		h.Response.Headers["Content-Type"] = contentType
+	}
+}
+
+// Redirect 重定向到location，code 需要是3xx或201
+func (h *HttpContext) Redirect(code int, location string) {
+	if (code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect) && code != http.StatusCreated {
+		panic(fmt.Sprintf("cannot redirect with status code %d", code))
+	}
+	h.Response.Status = int32(code)
+	h.Response.Body = nil
+	h.Response.Headers["Location"] = location
+}
+
+// Status 设置响应的状态码
+func (h *HttpContext) Status(code int) {
+	h.Response.Status = int32(code)
+}
+
+// Header 设置响应头，value为空时删除该响应头
+func (h *HttpContext) Header(key, value string) {
+	if value == "" {
+		delete(h.Response.Headers, key)
+		return
+	}
+	h.Response.Headers[key] = value
+}
+
+// AbortWithStatus 设置状态码并阻止后续的处理函数执行
+func (h *HttpContext) AbortWithStatus(code int) {
+	h.Status(code)
+	h.Abort()
+}
+
+// AbortWithError 返回 {"msg": err.Error(), "status": code} 并阻止后续的处理函数执行
+//
+// 与 ResponseError 不同，状态码由调用方决定。
+func (h *HttpContext) AbortWithError(code int, err error) {
+	h.JSON(code, map[string]interface{}{
+		"msg":    err.Error(),
+		"status": code,
+	})
+	h.Abort()
+}
+
 func (h *HttpContext) ResponseError(err error) {
 	data, _ := json.Marshal(map[string]interface{}{
 		"msg":    err.Error(),
@@ -0,0 +1,58 @@
+package pdk_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+	"github.com/WuKongIM/wklog"
+	"go.uber.org/zap"
+)
+
+// errorLogger 记录错误日志
+type errorLogger struct {
+	wklog.Log
+	mu   sync.Mutex
+	errs []string
+}
+
+func (l *errorLogger) Error(msg string, fields ...zap.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, msg)
+}
+
+func (l *errorLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.errs...)
+}
+
+func TestReplyErrorLoggedByServer(t *testing.T) {
+	host, err := pdktest.NewHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	host.Handle("/message/send", func(body []byte) ([]byte, error) {
+		return nil, errors.New("send failed")
+	})
+
+	log := &errorLogger{Log: wklog.NewWKLog("test")}
+	p := pdk.New("wk.plugin.test").OnReceive(func(c *pdk.Context) {
+		c.Reply([]byte(`{"type":1,"content":"hi"}`))
+	})
+	if err := host.Run(p, pdk.WithLogger(log), pdk.WithReplySync(true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.Receive(&pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "bot", ChannelType: 1}); err != nil {
+		t.Fatal(err)
+	}
+	errs := log.messages()
+	if len(errs) != 1 || errs[0] != "Reply error" {
+		t.Fatalf("errors: %v", errs)
+	}
+}
@@ -0,0 +1,34 @@
+package pdk
+
+import "github.com/WuKongIM/go-pdk/pdk/pluginproto"
+
+// HostAPI 插件可以调用的WuKongIM服务端接口，*Server 为默认实现
+//
+// 业务代码通过 Context.Host()、HttpContext.Host() 或实现 SetHost(HostAPI) 方法获取，
+// 单元测试中可以替换为 pdktest.FakeHost 之类的内存实现。
+type HostAPI interface {
+	// Request 向服务端发送请求
+	Request(requestPath string, data []byte) ([]byte, error)
+	// GetChannelMessages 获取频道消息
+	GetChannelMessages(req *pluginproto.ChannelMessageBatchReq) (*pluginproto.ChannelMessageBatchResp, error)
+	// ForwardHttp 转发插件http请求
+	ForwardHttp(req *pluginproto.ForwardHttpReq) (*pluginproto.HttpResponse, error)
+	// ConversationChannels 查询用户最近会话的频道
+	ConversationChannels(uid string) (*pluginproto.ConversationChannelResp, error)
+	// ClusterChannelBelongNode 获取频道所属节点
+	ClusterChannelBelongNode(req *pluginproto.ClusterChannelBelongNodeReq) (*pluginproto.ClusterChannelBelongNodeBatchResp, error)
+	// RequestStreamOpen 请求打开流
+	RequestStreamOpen(streamInfo *pluginproto.Stream) (*pluginproto.StreamOpenResp, error)
+	// RequestStreamCloseReq 请求关闭流
+	RequestStreamCloseReq(req *pluginproto.StreamCloseReq) error
+	// RequestStreamWriteResp 请求写入流，返回写入的消息ID和客户端消息编号
+	RequestStreamWriteResp(req *pluginproto.StreamWriteReq) (*pluginproto.StreamWriteResp, error)
+	// RequestSend 请求发送消息
+	RequestSend(req *pluginproto.SendReq) (*pluginproto.SendResp, error)
+	// NodeId 服务端节点ID（插件安装的节点）
+	NodeId() uint64
+	// SandboxDir 插件沙箱目录
+	SandboxDir() string
+}
+
+var _ HostAPI = (*Server)(nil)
@@ -0,0 +1,186 @@
+package pdk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	AllowOrigins     []string      // 允许的来源，为空或包含 * 表示允许所有来源
+	AllowMethods     []string      // 允许的请求方法，为空时使用常用的请求方法
+	AllowHeaders     []string      // 允许的请求头，为空时使用预检请求中的请求头
+	ExposeHeaders    []string      // 允许客户端读取的响应头
+	AllowCredentials bool          // 是否允许携带凭证
+	MaxAge           time.Duration // 预检请求结果的缓存时间
+}
+
+// CORS 跨域中间件，预检请求（OPTIONS）会直接返回204
+func CORS(cfg CORSConfig) Handler {
+	allowAll := len(cfg.AllowOrigins) == 0 || contains(cfg.AllowOrigins, "*")
+	allowMethods := cfg.AllowMethods
+	if len(allowMethods) == 0 {
+		allowMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions}
+	}
+	return func(c *HttpContext) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		if !allowAll && !contains(cfg.AllowOrigins, origin) {
+			c.Response.Status = http.StatusForbidden
+			c.Response.Body = nil
+			c.Abort()
+			return
+		}
+
+		headers := c.Response.Headers
+		if allowAll && !cfg.AllowCredentials {
+			headers["Access-Control-Allow-Origin"] = "*"
+		} else {
+			headers["Access-Control-Allow-Origin"] = origin
+			headers["Vary"] = "Origin"
+		}
+		if cfg.AllowCredentials {
+			headers["Access-Control-Allow-Credentials"] = "true"
+		}
+		if len(cfg.ExposeHeaders) > 0 {
+			headers["Access-Control-Expose-Headers"] = strings.Join(cfg.ExposeHeaders, ", ")
+		}
+
+		// 预检请求
+		if strings.EqualFold(c.Request.Method, http.MethodOptions) && c.GetHeader("Access-Control-Request-Method") != "" {
+			headers["Access-Control-Allow-Methods"] = strings.Join(allowMethods, ", ")
+			if len(cfg.AllowHeaders) > 0 {
+				headers["Access-Control-Allow-Headers"] = strings.Join(cfg.AllowHeaders, ", ")
+			} else if reqHeaders := c.GetHeader("Access-Control-Request-Headers"); reqHeaders != "" {
+				headers["Access-Control-Allow-Headers"] = reqHeaders
+			}
+			if cfg.MaxAge > 0 {
+				headers["Access-Control-Max-Age"] = strconv.FormatInt(int64(cfg.MaxAge/time.Second), 10)
+			}
+			c.Response.Status = http.StatusNoContent
+			c.Response.Body = nil
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Logger 请求日志中间件，记录请求方法、路径、状态码和耗时
+func Logger() Handler {
+	return func(c *HttpContext) {
+		start := time.Now()
+		c.Next()
+		hostLog(c.host, "HttpLogger").Info("http request",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.Path),
+			zap.String("route", c.FullPath()),
+			zap.Int32("status", c.Response.Status),
+			zap.Duration("cost", time.Since(start)),
+		)
+	}
+}
+
+// Recovery 恢复路由处理函数中的panic，返回500
+func Recovery() Handler {
+	return func(c *HttpContext) {
+		defer func() {
+			if r := recover(); r != nil {
+				hostLog(c.host, "HttpRecovery").Error("http handler panic",
+					zap.String("method", c.Request.Method),
+					zap.String("path", c.Request.Path),
+					zap.Any("panic", r),
+					zap.ByteString("stack", debug.Stack()),
+				)
+				abortWithStatus(c, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		c.Next()
+	}
+}
+
+// BearerAuth 校验请求头 Authorization: Bearer <token>，token需要与secret一致
+//
+// secret 在每次请求时获取，一般返回插件配置中的 SecretKey 字段，配置更新后立即生效；
+// secret 为空时拒绝所有请求。
+func BearerAuth(secret func() SecretKey) Handler {
+	return func(c *HttpContext) {
+		key := secret().String()
+		auth := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if key == "" || !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(key)) != 1 {
+			c.Response.Headers["WWW-Authenticate"] = "Bearer"
+			abortWithStatus(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		c.Next()
+	}
+}
+
+const (
+	// HMACSignatureHeader HMAC签名的请求头
+	HMACSignatureHeader = "X-Signature"
+	// HMACTimestampHeader HMAC签名时间戳（unix秒）的请求头
+	HMACTimestampHeader = "X-Timestamp"
+	// hmacMaxSkew 允许的签名时间误差
+	hmacMaxSkew = 5 * time.Minute
+)
+
+// SignHMAC 计算请求的HMAC签名（hex编码的HMAC-SHA256）
+//
+// 签名内容为：timestamp + "\n" + method + "\n" + path + "\n" + body
+func SignHMAC(secret SecretKey, timestamp, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + strings.ToUpper(method) + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACAuth 校验请求的HMAC签名，签名方式见 SignHMAC
+//
+// 请求需要携带 X-Timestamp 和 X-Signature 请求头，时间戳与当前时间相差超过5分钟的请求会被拒绝；
+// secret 为空时拒绝所有请求。
+func HMACAuth(secret func() SecretKey) Handler {
+	return func(c *HttpContext) {
+		key := secret()
+		timestamp := c.GetHeader(HMACTimestampHeader)
+		signature := c.GetHeader(HMACSignatureHeader)
+		if key == "" || timestamp == "" || signature == "" {
+			abortWithStatus(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			abortWithStatus(c, http.StatusUnauthorized, "invalid timestamp")
+			return
+		}
+		skew := time.Since(time.Unix(ts, 0))
+		if skew > hmacMaxSkew || skew < -hmacMaxSkew {
+			abortWithStatus(c, http.StatusUnauthorized, "timestamp expired")
+			return
+		}
+		expected := SignHMAC(key, timestamp, c.Request.Method, c.Request.Path, c.Request.Body)
+		if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+			abortWithStatus(c, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortWithStatus(c *HttpContext, status int, msg string) {
+	c.AbortWithError(status, errors.New(msg))
+}
@@ -0,0 +1,189 @@
+package pdk
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func serveMiddleware(middleware Handler, req *pluginproto.HttpRequest) *HttpContext {
+	r := newRoute()
+	r.Use(middleware)
+	r.Any("/hello", func(c *HttpContext) {
+		c.String(http.StatusOK, "hello")
+	})
+	c := NewHttpContext(nil, req)
+	r.handle(c)
+	return c
+}
+
+func TestCORS(t *testing.T) {
+	cfg := CORSConfig{
+		AllowOrigins:     []string{"https://a.com"},
+		AllowMethods:     []string{http.MethodGet, http.MethodPost},
+		AllowCredentials: true,
+		ExposeHeaders:    []string{"X-Total"},
+		MaxAge:           time.Hour,
+	}
+	tests := []struct {
+		name    string
+		cfg     CORSConfig
+		method  string
+		headers map[string]string
+		status  int32
+		body    string
+		want    map[string]string // 为空字符串表示不应该有此响应头
+	}{
+		{
+			name: "no origin", cfg: cfg, method: http.MethodGet,
+			status: http.StatusOK, body: "hello",
+			want: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "disallowed origin", cfg: cfg, method: http.MethodGet,
+			headers: map[string]string{"Origin": "https://b.com"},
+			status:  http.StatusForbidden,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "allowed origin", cfg: cfg, method: http.MethodGet,
+			headers: map[string]string{"Origin": "https://a.com"},
+			status:  http.StatusOK, body: "hello",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://a.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total",
+				"Vary":                             "Origin",
+				"Access-Control-Allow-Methods":     "",
+			},
+		},
+		{
+			name: "preflight", cfg: cfg, method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://a.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "Content-Type",
+			},
+			status: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://a.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+		{
+			name: "preflight with allow headers", cfg: CORSConfig{AllowHeaders: []string{"Authorization", "Content-Type"}}, method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://b.com",
+				"Access-Control-Request-Method":  http.MethodPut,
+				"Access-Control-Request-Headers": "X-Custom",
+			},
+			status: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS",
+				"Access-Control-Allow-Headers": "Authorization, Content-Type",
+				"Access-Control-Max-Age":       "",
+			},
+		},
+		{
+			name: "options without request method", cfg: cfg, method: http.MethodOptions,
+			headers: map[string]string{"Origin": "https://a.com"},
+			status:  http.StatusOK, body: "hello",
+			want: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := serveMiddleware(CORS(tt.cfg), &pluginproto.HttpRequest{Method: tt.method, Path: "/hello", Headers: tt.headers})
+			if c.Response.Status != tt.status {
+				t.Fatalf("status: got %d, want %d", c.Response.Status, tt.status)
+			}
+			if string(c.Response.Body) != tt.body {
+				t.Fatalf("body: got %q, want %q", c.Response.Body, tt.body)
+			}
+			for k, v := range tt.want {
+				if got := c.Response.Headers[k]; got != v {
+					t.Fatalf("header %s: got %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret SecretKey
+		auth   string
+		status int32
+	}{
+		{name: "valid", secret: "s3cret", auth: "Bearer s3cret", status: http.StatusOK},
+		{name: "missing", secret: "s3cret", status: http.StatusUnauthorized},
+		{name: "bad token", secret: "s3cret", auth: "Bearer wrong", status: http.StatusUnauthorized},
+		{name: "wrong scheme", secret: "s3cret", auth: "Basic s3cret", status: http.StatusUnauthorized},
+		{name: "empty secret", auth: "Bearer ", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &pluginproto.HttpRequest{Method: http.MethodGet, Path: "/hello"}
+			if tt.auth != "" {
+				req.Headers = map[string]string{"Authorization": tt.auth}
+			}
+			c := serveMiddleware(BearerAuth(func() SecretKey { return tt.secret }), req)
+			if c.Response.Status != tt.status {
+				t.Fatalf("status: got %d, want %d", c.Response.Status, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && c.Response.Headers["WWW-Authenticate"] != "Bearer" {
+				t.Fatalf("WWW-Authenticate: %q", c.Response.Headers["WWW-Authenticate"])
+			}
+		})
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	const secret SecretKey = "s3cret"
+	body := []byte(`{"a":1}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-6*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(6*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    SecretKey
+		timestamp string
+		signature string
+		status    int32
+	}{
+		{name: "valid", secret: secret, timestamp: now, signature: SignHMAC(secret, now, http.MethodPost, "/hello", body), status: http.StatusOK},
+		{name: "upper case signature", secret: secret, timestamp: now, signature: strings.ToUpper(SignHMAC(secret, now, http.MethodPost, "/hello", body)), status: http.StatusOK},
+		{name: "bad signature", secret: secret, timestamp: now, signature: SignHMAC("other", now, http.MethodPost, "/hello", body), status: http.StatusUnauthorized},
+		{name: "signed other path", secret: secret, timestamp: now, signature: SignHMAC(secret, now, http.MethodPost, "/other", body), status: http.StatusUnauthorized},
+		{name: "expired timestamp", secret: secret, timestamp: old, signature: SignHMAC(secret, old, http.MethodPost, "/hello", body), status: http.StatusUnauthorized},
+		{name: "future timestamp", secret: secret, timestamp: future, signature: SignHMAC(secret, future, http.MethodPost, "/hello", body), status: http.StatusUnauthorized},
+		{name: "invalid timestamp", secret: secret, timestamp: "abc", signature: SignHMAC(secret, "abc", http.MethodPost, "/hello", body), status: http.StatusUnauthorized},
+		{name: "missing headers", secret: secret, status: http.StatusUnauthorized},
+		{name: "empty secret", timestamp: now, signature: SignHMAC("", now, http.MethodPost, "/hello", body), status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.timestamp != "" {
+				headers[HMACTimestampHeader] = tt.timestamp
+			}
+			if tt.signature != "" {
+				headers[HMACSignatureHeader] = tt.signature
+			}
+			req := &pluginproto.HttpRequest{Method: http.MethodPost, Path: "/hello", Headers: headers, Body: body}
+			c := serveMiddleware(HMACAuth(func() SecretKey { return tt.secret }), req)
+			if c.Response.Status != tt.status {
+				t.Fatalf("status: got %d, want %d", c.Response.Status, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package pdk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Keys 请求范围内的键值存储，用于在中间件和处理函数之间传递数据
+//
+// Context 和 HttpContext 都内嵌了 Keys，可以直接调用 Set、Get 等方法。
+type Keys struct {
+	mu sync.RWMutex
+	m  map[string]interface{}
+}
+
+// Set 保存键值
+func (k *Keys) Set(key string, value interface{}) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.m == nil {
+		k.m = make(map[string]interface{})
+	}
+	k.m[key] = value
+}
+
+// Get 获取键值，exists 表示key是否存在
+func (k *Keys) Get(key string) (value interface{}, exists bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	value, exists = k.m[key]
+	return
+}
+
+// MustGet 获取键值，key不存在时panic
+func (k *Keys) MustGet(key string) interface{} {
+	if value, exists := k.Get(key); exists {
+		return value
+	}
+	panic(fmt.Sprintf("key \"%s\" does not exist", key))
+}
+
+// GetString 获取字符串类型的键值，不存在或类型不匹配时返回空字符串
+func (k *Keys) GetString(key string) string {
+	value, _ := k.Get(key)
+	s, _ := value.(string)
+	return s
+}
+
+// Value 获取指定类型的键值，不存在或类型不匹配时ok为false
+func Value[T any](k interface {
+	Get(key string) (interface{}, bool)
+}, key string) (v T, ok bool) {
+	value, exists := k.Get(key)
+	if !exists {
+		return v, false
+	}
+	v, ok = value.(T)
+	return v, ok
+}
+
+// requestContext 创建请求的 context.Context，派生自服务的根上下文，timeout 为0时不设置超时
+func requestContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
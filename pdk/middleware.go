@@ -0,0 +1,55 @@
+package pdk
+
+// HookHandler Send、Receive、PersistAfter 钩子的处理函数，也用作钩子中间件
+//
+// 中间件内调用 c.Next() 执行后续的处理函数，调用 c.Abort() 阻止后续的处理函数执行。
+type HookHandler func(*Context)
+
+type hookMiddleware struct {
+	methods []PluginMethod // 作用的钩子，为空表示所有钩子
+	handler HookHandler
+}
+
+func (m hookMiddleware) match(method PluginMethod) bool {
+	if len(m.methods) == 0 {
+		return true
+	}
+	for _, md := range m.methods {
+		if md == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Use 添加作用于所有钩子（Send、Receive、PersistAfter）的中间件，按添加顺序执行
+func Use(middleware ...HookHandler) Option {
+	return func(o *Options) {
+		for _, h := range middleware {
+			o.middlewares = append(o.middlewares, hookMiddleware{handler: h})
+		}
+	}
+}
+
+// UseFor 添加只作用于指定钩子的中间件，与 Use 添加的中间件一起按添加顺序执行
+func UseFor(method PluginMethod, middleware ...HookHandler) Option {
+	return func(o *Options) {
+		for _, h := range middleware {
+			o.middlewares = append(o.middlewares, hookMiddleware{methods: []PluginMethod{method}, handler: h})
+		}
+	}
+}
+
+// 生成钩子的处理链（中间件 + 插件和各模块的处理函数）
+func buildHookChain(middlewares []hookMiddleware, method PluginMethod, handlers ...HookHandler) []HookHandler {
+	if len(handlers) == 0 {
+		return nil
+	}
+	chain := make([]HookHandler, 0, len(middlewares)+len(handlers))
+	for _, m := range middlewares {
+		if m.match(method) {
+			chain = append(chain, m.handler)
+		}
+	}
+	return append(chain, handlers...)
+}
@@ -0,0 +1,246 @@
+package pdk
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// Module 插件模块，一个插件进程可以组合多个相互独立的模块（例如关键词过滤、审计日志、管理接口）
+//
+// 每个模块有自己的：
+//   - 配置命名空间：配置中以模块名为key的对象，通过 pdk.ModuleConfigFrom[T](c.Host(), name) 获取
+//   - 路由前缀：默认为 /模块名，通过 Prefix 修改
+//   - 钩子处理链中的位置：Order 越小越先执行，相同时按注册顺序执行，插件自身的钩子的 Order 为0
+//
+// 模块的钩子调用 c.Abort() 或返回错误后，后续模块的钩子不会执行。
+//
+//	filter := pdk.NewModule("filter").Order(10).OnSend(...).WithConfig(pdk.TypedConfig[FilterConfig](nil))
+//	audit := pdk.NewModule("audit").Order(20).OnPersistAfter(...)
+//	admin := pdk.NewModule("admin").Routes(func(g *pdk.RouterGroup) { ... })
+//
+//	pdk.RunServer(newPlugin, "wk.plugin.suite", pdk.WithModules(filter, audit, admin))
+type Module struct {
+	name   string
+	prefix string
+	order  int
+	hooks  map[PluginMethod]func(*Context)
+	routes func(*RouterGroup)
+	setup  func()
+	stop   func()
+	host   func(HostAPI)
+	config *ConfigBinding
+}
+
+// NewModule 创建模块，name 为模块名，同一个插件中不能重复
+func NewModule(name string) *Module {
+	if name == "" {
+		panic("module name must not be empty")
+	}
+	return &Module{
+		name:   name,
+		prefix: "/" + name,
+		hooks:  map[PluginMethod]func(*Context){},
+	}
+}
+
+// Name 模块名
+func (m *Module) Name() string {
+	return m.name
+}
+
+// Prefix 设置模块路由的前缀，为空或 / 时注册在根路径下
+func (m *Module) Prefix(prefix string) *Module {
+	m.prefix = prefix
+	return m
+}
+
+// Order 设置模块的钩子在处理链中的位置，越小越先执行
+func (m *Module) Order(order int) *Module {
+	m.order = order
+	return m
+}
+
+// OnSend 注册发送消息的钩子，可以修改 c.SendPacket
+func (m *Module) OnSend(handler func(*Context)) *Module {
+	return m.hook(PluginSend, handler)
+}
+
+// OnSendE 注册返回错误的发送消息钩子，返回的错误会返回给服务端
+func (m *Module) OnSendE(handler func(*Context) error) *Module {
+	return m.hook(PluginSend, hookHandlerE(handler))
+}
+
+// OnPersistAfter 注册消息存储后的钩子
+func (m *Module) OnPersistAfter(handler func(*Context)) *Module {
+	return m.hook(PluginPersistAfter, handler)
+}
+
+// OnPersistAfterE 注册返回错误的消息存储后钩子
+func (m *Module) OnPersistAfterE(handler func(*Context) error) *Module {
+	return m.hook(PluginPersistAfter, hookHandlerE(handler))
+}
+
+// OnReceive 注册收到消息的钩子
+func (m *Module) OnReceive(handler func(*Context)) *Module {
+	return m.hook(PluginReceive, handler)
+}
+
+// OnReceiveE 注册返回错误的收到消息钩子
+func (m *Module) OnReceiveE(handler func(*Context) error) *Module {
+	return m.hook(PluginReceive, hookHandlerE(handler))
+}
+
+func (m *Module) hook(method PluginMethod, handler func(*Context)) *Module {
+	if handler == nil {
+		delete(m.hooks, method)
+		return m
+	}
+	m.hooks[method] = handler
+	return m
+}
+
+// Routes 注册模块的http路由，g 的路径前缀为模块的前缀
+func (m *Module) Routes(routes func(g *RouterGroup)) *Module {
+	m.routes = routes
+	return m
+}
+
+// OnSetup 注册插件第一次连接上服务端后的回调
+func (m *Module) OnSetup(setup func()) *Module {
+	m.setup = setup
+	return m
+}
+
+// OnStop 注册插件停止时的回调，模块按注册的相反顺序停止
+func (m *Module) OnStop(stop func()) *Module {
+	m.stop = stop
+	return m
+}
+
+// OnHost 注册获取服务端接口的回调，插件启动时调用
+func (m *Module) OnHost(host func(HostAPI)) *Module {
+	m.host = host
+	return m
+}
+
+// WithConfig 设置模块的配置类型，通过 TypedConfig 创建
+func (m *Module) WithConfig(config ConfigBinding) *Module {
+	m.config = &config
+	return m
+}
+
+// WithModules 添加插件模块，RunServer 和 New 创建的插件都可以使用
+func WithModules(modules ...*Module) Option {
+	return func(o *Options) {
+		o.modules = append(o.modules, modules...)
+	}
+}
+
+// checkModules 检查模块名是否重复或与插件自身的配置字段冲突
+func checkModules(def *Plugin, modules []*Module) error {
+	names := map[string]bool{}
+	if def.config != nil {
+		for _, f := range getFields(def.config.typ) {
+			names[f.Name] = true
+		}
+	}
+	for _, m := range modules {
+		if m == nil {
+			return fmt.Errorf("module is nil")
+		}
+		if names[m.name] {
+			return fmt.Errorf("module name %q conflicts with another module or config field", m.name)
+		}
+		names[m.name] = true
+	}
+	return nil
+}
+
+// hookHandlers 按顺序排列的插件自身和各模块的钩子处理函数
+func hookHandlers(def *Plugin, modules []*Module, method PluginMethod) []HookHandler {
+	type entry struct {
+		order   int
+		handler HookHandler
+	}
+	entries := []entry{}
+	if h := def.hooks[method]; h != nil {
+		entries = append(entries, entry{handler: h})
+	}
+	for _, m := range modules {
+		if h := m.hooks[method]; h != nil {
+			entries = append(entries, entry{order: m.order, handler: h})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].order < entries[j].order
+	})
+	handlers := make([]HookHandler, 0, len(entries))
+	for _, e := range entries {
+		handlers = append(handlers, e.handler)
+	}
+	return handlers
+}
+
+// pluginMethods 插件和各模块实现的方法，上报给服务端
+func pluginMethods(def *Plugin, modules []*Module) []string {
+	methods := []string{}
+	for _, method := range []PluginMethod{PluginSend, PluginPersistAfter, PluginReceive} {
+		if len(hookHandlers(def, modules, method)) > 0 {
+			methods = append(methods, method.String())
+		}
+	}
+	hasRoutes := def.routes != nil
+	for _, m := range modules {
+		hasRoutes = hasRoutes || m.routes != nil
+	}
+	if hasRoutes {
+		methods = append(methods, PluginRoute.String())
+	}
+	return methods
+}
+
+// buildRoute 注册插件和各模块的http路由，都没有路由时返回nil
+func buildRoute(def *Plugin, modules []*Module) *Route {
+	var r *Route
+	if def.routes != nil {
+		r = newRoute()
+		def.routes(r)
+	}
+	for _, m := range modules {
+		if m.routes == nil {
+			continue
+		}
+		if r == nil {
+			r = newRoute()
+		}
+		m.routes(r.Group(m.prefix))
+	}
+	return r
+}
+
+// configSlots 插件自身（name为空）和各模块的配置
+func configSlots(def *Plugin, modules []*Module) []*configSlot {
+	slots := []*configSlot{}
+	if def.config != nil {
+		slots = append(slots, &configSlot{typ: def.config.typ, onUpdate: def.config.onUpdate})
+	}
+	for _, m := range modules {
+		if m.config != nil {
+			slots = append(slots, &configSlot{name: m.name, typ: m.config.typ, onUpdate: m.config.onUpdate})
+		}
+	}
+	return slots
+}
+
+// moduleConfigField 模块配置在配置模版中的对象字段
+func moduleConfigField(name string, typ reflect.Type) *pluginproto.Field {
+	return &pluginproto.Field{
+		Name:   name,
+		Label:  name,
+		Type:   FieldTypeObject,
+		Fields: getFields(typ),
+	}
+}
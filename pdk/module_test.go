@@ -0,0 +1,199 @@
+package pdk_test
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// callOrder 记录钩子的执行顺序
+type callOrder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (o *callOrder) hook(name string) func(*pdk.Context) {
+	return func(c *pdk.Context) {
+		o.mu.Lock()
+		o.names = append(o.names, name)
+		o.mu.Unlock()
+	}
+}
+
+func (o *callOrder) list() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.names...)
+}
+
+func TestModuleHookOrder(t *testing.T) {
+	host := newRunningHost(t)
+	order := &callOrder{}
+	p := pdk.New("wk.plugin.modules").OnSend(order.hook("plugin"))
+	err := host.Run(p, pdk.WithModules(
+		pdk.NewModule("audit").Order(20).OnSend(order.hook("audit")),
+		pdk.NewModule("filter").Order(10).OnSend(order.hook("filter")),
+		pdk.NewModule("auth").Order(-1).OnSend(order.hook("auth")),
+		pdk.NewModule("metrics").Order(10).OnSend(order.hook("metrics")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// Order 越小越先执行，相同时按注册顺序
+	want := []string{"auth", "plugin", "filter", "metrics", "audit"}
+	if got := order.list(); !slices.Equal(got, want) {
+		t.Fatalf("order: got %v, want %v", got, want)
+	}
+}
+
+func TestModuleAbortStopsLaterModules(t *testing.T) {
+	host := newRunningHost(t)
+	order := &callOrder{}
+	p := pdk.New("wk.plugin.modules").OnSend(order.hook("plugin"))
+	err := host.Run(p, pdk.WithModules(
+		pdk.NewModule("filter").Order(-1).OnSend(func(c *pdk.Context) {
+			order.hook("filter")(c)
+			if strings.Contains(string(c.SendPacket.Payload), "bad") {
+				c.SendPacket.Payload = []byte("***")
+				c.Abort()
+			}
+		}),
+		pdk.NewModule("audit").Order(10).OnSend(order.hook("audit")),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1, Payload: []byte("bad word")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sent.Payload) != "***" {
+		t.Fatalf("payload: %s", sent.Payload)
+	}
+	if got := order.list(); !slices.Equal(got, []string{"filter"}) {
+		t.Fatalf("order: %v", got)
+	}
+
+	if _, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1, Payload: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := order.list(); !slices.Equal(got, []string{"filter", "filter", "plugin", "audit"}) {
+		t.Fatalf("order: %v", got)
+	}
+}
+
+type moduleConfig struct {
+	Word string `json:"word" default:"bad"`
+}
+
+func TestModuleRoutesAndConfig(t *testing.T) {
+	host := newRunningHost(t)
+	hello := func(c *pdk.HttpContext) {
+		c.String(http.StatusOK, "%s", c.FullPath())
+	}
+	p := pdk.New("wk.plugin.modules").Routes(func(r *pdk.Route) {
+		r.GET("/hello", hello)
+	})
+	err := host.Run(p, pdk.WithModules(
+		pdk.NewModule("filter").
+			WithConfig(pdk.TypedConfig[moduleConfig](nil)).
+			Routes(func(g *pdk.RouterGroup) {
+				g.GET("/hello", hello)
+				g.GET("/word", func(c *pdk.HttpContext) {
+					c.String(http.StatusOK, "%s", pdk.ModuleConfigFrom[moduleConfig](c.Host(), "filter").Word)
+				})
+			}),
+		pdk.NewModule("admin").Prefix("/api/admin").Routes(func(g *pdk.RouterGroup) {
+			g.GET("/hello", hello)
+		}),
+		pdk.NewModule("root").Prefix("/").Routes(func(g *pdk.RouterGroup) {
+			g.GET("/ping", hello)
+		}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		status int32
+		body   string
+	}{
+		{path: "/hello", status: http.StatusOK, body: "/hello"},
+		{path: "/filter/hello", status: http.StatusOK, body: "/filter/hello"},
+		{path: "/filter/word", status: http.StatusOK, body: "bad"},
+		{path: "/api/admin/hello", status: http.StatusOK, body: "/api/admin/hello"},
+		{path: "/admin/hello", status: http.StatusNotFound, body: "404 page not found"},
+		{path: "/ping", status: http.StatusOK, body: "/ping"},
+	}
+	for _, tt := range tests {
+		resp, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodGet, Path: tt.path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != tt.status || string(resp.Body) != tt.body {
+			t.Fatalf("%s: %d %s", tt.path, resp.Status, resp.Body)
+		}
+	}
+
+	if err := host.ConfigUpdate(map[string]interface{}{"filter": map[string]interface{}{"word": "spam"}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodGet, Path: "/filter/word"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "spam" {
+		t.Fatalf("module config: %s", resp.Body)
+	}
+}
+
+type pluginConfig struct {
+	Filter string `json:"filter"`
+}
+
+func TestModuleNameConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugin  *pdk.Plugin
+		modules []*pdk.Module
+	}{
+		{
+			name:    "duplicate module",
+			plugin:  pdk.New("wk.plugin.modules"),
+			modules: []*pdk.Module{pdk.NewModule("filter"), pdk.NewModule("filter")},
+		},
+		{
+			name:    "config field",
+			plugin:  pdk.New("wk.plugin.modules").WithConfig(pdk.TypedConfig[pluginConfig](nil)),
+			modules: []*pdk.Module{pdk.NewModule("filter")},
+		},
+		{
+			name:    "nil module",
+			plugin:  pdk.New("wk.plugin.modules"),
+			modules: []*pdk.Module{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := pdktest.NewHost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer host.Close()
+			if err := host.Run(tt.plugin, pdk.WithModules(tt.modules...)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
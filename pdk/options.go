@@ -1,18 +1,53 @@
 package pdk
 
+import (
+	"os"
+	"time"
+
+	"github.com/WuKongIM/wklog"
+)
+
+// 未通过选项设置时，socket路径和沙箱目录从环境变量中读取
+const (
+	EnvSocketPath = "PDK_SOCKET"  // 连接WuKongIM的unix socket路径
+	EnvSandbox    = "PDK_SANDBOX" // 沙箱目录
+)
+
 type Options struct {
 	No               string // 插件唯一编号
 	PersistAfterSync bool   // PersistAfter方法是否同步调用
 	ReplySync        bool   // Reply方法是否同步调用
 	Version          string
 	Priority         int32
-	Sandbox          string // 沙箱目录
+	Sandbox          string          // 沙箱目录
+	SocketPath       string          // 连接WuKongIM的unix socket路径
+	SendPanicPolicy  SendPanicPolicy // Send钩子发生panic时的处理策略
+	RequestTimeout   time.Duration   // 每个请求（钩子、路由）的 context.Context 超时时间，0表示不超时
+	LocalConfig      bool            // 是否读取本地配置（沙箱目录中的config.yaml|yml|json和PDK_CONFIG_*环境变量）
+	ConfigFile       string          // 本地配置文件路径，为空时在沙箱目录中查找
+	ShutdownTimeout  time.Duration   // 停止时等待正在处理的请求完成的最长时间，0表示一直等待
+
+	StreamIdleTimeout time.Duration // 流超过多久没有写入时自动关闭，默认 DefaultStreamIdleTimeout，0表示不限制
+	StreamMaxLifetime time.Duration // 流打开后最多多久自动关闭，默认 DefaultStreamMaxLifetime，0表示不限制
+	StreamBindRequest bool          // c.OpenStream 打开的流是否在请求结束时自动关闭
+
+	Logger wklog.Log // 插件的日志，为空时使用 wklog 的全局日志并写入沙箱目录的logs中
+
+	middlewares []hookMiddleware // 钩子中间件
+	modules     []*Module        // 插件模块
+	onReady     []func(*Server)  // 插件启动完成后的回调
 }
 
 func newOptions() *Options {
 	return &Options{
-		Version:  "0.0.0",
-		Priority: 0,
+		Version:         "0.0.0",
+		Priority:        0,
+		SocketPath:      os.Getenv(EnvSocketPath),
+		Sandbox:         os.Getenv(EnvSandbox),
+		ShutdownTimeout: 10 * time.Second,
+
+		StreamIdleTimeout: DefaultStreamIdleTimeout,
+		StreamMaxLifetime: DefaultStreamMaxLifetime,
 	}
 }
 
@@ -53,3 +88,89 @@ func WithSandbox(sandbox string) Option {
 		o.Sandbox = sandbox
 	}
 }
+
+func WithSocketPath(socketPath string) Option {
+	return func(o *Options) {
+		o.SocketPath = socketPath
+	}
+}
+
+func WithSendPanicPolicy(policy SendPanicPolicy) Option {
+	return func(o *Options) {
+		o.SendPanicPolicy = policy
+	}
+}
+
+// WithRequestTimeout 设置每个请求（钩子、路由）的 context.Context 超时时间，默认不超时
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.RequestTimeout = timeout
+	}
+}
+
+// WithLocalConfig 开启本地配置，本地配置会与服务端下发的配置合并，服务端的配置优先
+func WithLocalConfig(enabled bool) Option {
+	return func(o *Options) {
+		o.LocalConfig = enabled
+	}
+}
+
+// WithConfigFile 指定本地配置文件（yaml或json），同时开启本地配置
+func WithConfigFile(file string) Option {
+	return func(o *Options) {
+		o.ConfigFile = file
+		o.LocalConfig = true
+	}
+}
+
+// WithShutdownTimeout 设置停止时等待正在处理的请求（钩子、路由）完成的最长时间
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.ShutdownTimeout = timeout
+	}
+}
+
+// WithStreamIdleTimeout 设置插件打开的流的默认空闲超时，默认为 DefaultStreamIdleTimeout，0表示不限制，
+// 可以通过 StreamWithIdleTimeout 为单个流设置
+//
+// 大模型思考阶段可能长时间没有输出，需要设置得足够大。
+func WithStreamIdleTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.StreamIdleTimeout = timeout
+	}
+}
+
+// WithStreamMaxLifetime 设置插件打开的流的默认最长存活时间，默认为 DefaultStreamMaxLifetime，0表示不限制，
+// 可以通过 StreamWithMaxLifetime 为单个流设置
+func WithStreamMaxLifetime(lifetime time.Duration) Option {
+	return func(o *Options) {
+		o.StreamMaxLifetime = lifetime
+	}
+}
+
+// WithStreamBindRequest 设置 c.OpenStream 打开的流在请求结束（处理函数返回、panic或超时）时自动关闭
+//
+// 开启后不能在处理函数返回后（例如在新的goroutine中）继续写入流，单个流可以通过 StreamWithContext 设置。
+func WithStreamBindRequest(bind bool) Option {
+	return func(o *Options) {
+		o.StreamBindRequest = bind
+	}
+}
+
+// WithLogger 设置插件（包括服务、请求上下文和流）使用的日志
+//
+// 设置后不再修改 wklog 的全局配置（日志目录），同一个进程中运行多个插件（例如在测试中）时每个插件可以使用自己的日志。
+func WithLogger(logger wklog.Log) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithOnReady 设置插件启动完成后的回调：第一次连接上服务端、应用了配置并调用了 Setup 之后调用
+//
+// 可以用于健康检查或在测试中等待插件就绪，多次设置时按顺序调用。
+func WithOnReady(onReady func(s *Server)) Option {
+	return func(o *Options) {
+		o.onReady = append(o.onReady, onReady)
+	}
+}
@@ -0,0 +1,15 @@
+package pdk
+
+import "testing"
+
+// 没有额外设置时，忘记关闭的流最终也会被关闭
+func TestStreamTimeoutDefaults(t *testing.T) {
+	opts := newOptions()
+	if opts.StreamIdleTimeout != DefaultStreamIdleTimeout || opts.StreamMaxLifetime != DefaultStreamMaxLifetime {
+		t.Fatalf("plugin options: idle %v, lifetime %v", opts.StreamIdleTimeout, opts.StreamMaxLifetime)
+	}
+	streamOpts := newStreamOptions()
+	if streamOpts.IdleTimeout != DefaultStreamIdleTimeout || streamOpts.MaxLifetime != DefaultStreamMaxLifetime {
+		t.Fatalf("stream options: idle %v, lifetime %v", streamOpts.IdleTimeout, streamOpts.MaxLifetime)
+	}
+}
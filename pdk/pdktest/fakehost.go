@@ -0,0 +1,99 @@
+package pdktest
+
+import (
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// FakeHost 内存中的 pdk.HostAPI 实现，不依赖wkrpc
+//
+// 与Host一样记录插件发起的请求并返回默认响应，可以通过 Handle 自定义某个路径的响应，
+// 适合配合 pdk.NewRecvContext 等函数对业务逻辑做表驱动测试。
+type FakeHost struct {
+	*recorder
+	nodeId     uint64
+	sandboxDir string
+}
+
+var _ pdk.HostAPI = (*FakeHost)(nil)
+
+// NewFakeHost 创建内存中的服务端接口
+func NewFakeHost(opt ...Option) *FakeHost {
+	opts := applyOptions(opt)
+	return &FakeHost{
+		recorder:   newRecorder(opts.StartupResp.NodeId),
+		nodeId:     opts.StartupResp.NodeId,
+		sandboxDir: opts.StartupResp.SandboxDir,
+	}
+}
+
+// Handle 自定义插件请求某个路径时的响应
+func (f *FakeHost) Handle(p string, handler HandlerFunc) {
+	f.setHandler(p, handler)
+}
+
+func (f *FakeHost) Request(requestPath string, data []byte) ([]byte, error) {
+	return f.handle(requestPath, append([]byte(nil), data...))
+}
+
+func (f *FakeHost) GetChannelMessages(req *pluginproto.ChannelMessageBatchReq) (*pluginproto.ChannelMessageBatchResp, error) {
+	return call(f, "/channel/messages", req, &pluginproto.ChannelMessageBatchResp{})
+}
+
+func (f *FakeHost) ForwardHttp(req *pluginproto.ForwardHttpReq) (*pluginproto.HttpResponse, error) {
+	return call(f, "/plugin/httpForward", req, &pluginproto.HttpResponse{})
+}
+
+func (f *FakeHost) ConversationChannels(uid string) (*pluginproto.ConversationChannelResp, error) {
+	return call(f, "/conversation/channels", &pluginproto.ConversationChannelReq{Uid: uid}, &pluginproto.ConversationChannelResp{})
+}
+
+func (f *FakeHost) ClusterChannelBelongNode(req *pluginproto.ClusterChannelBelongNodeReq) (*pluginproto.ClusterChannelBelongNodeBatchResp, error) {
+	return call(f, "/cluster/channels/belongNode", req, &pluginproto.ClusterChannelBelongNodeBatchResp{})
+}
+
+func (f *FakeHost) RequestStreamOpen(streamInfo *pluginproto.Stream) (*pluginproto.StreamOpenResp, error) {
+	return call(f, "/stream/open", streamInfo, &pluginproto.StreamOpenResp{})
+}
+
+func (f *FakeHost) RequestStreamCloseReq(req *pluginproto.StreamCloseReq) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = f.Request("/stream/close", data)
+	return err
+}
+
+func (f *FakeHost) RequestStreamWriteResp(req *pluginproto.StreamWriteReq) (*pluginproto.StreamWriteResp, error) {
+	return call(f, "/stream/write", req, &pluginproto.StreamWriteResp{})
+}
+
+func (f *FakeHost) RequestSend(req *pluginproto.SendReq) (*pluginproto.SendResp, error) {
+	return call(f, "/message/send", req, &pluginproto.SendResp{})
+}
+
+func (f *FakeHost) NodeId() uint64 {
+	return f.nodeId
+}
+
+func (f *FakeHost) SandboxDir() string {
+	return f.sandboxDir
+}
+
+func call[Resp interface{ Unmarshal([]byte) error }](f *FakeHost, p string, req interface{ Marshal() ([]byte, error) }, resp Resp) (Resp, error) {
+	var empty Resp
+	data, err := req.Marshal()
+	if err != nil {
+		return empty, err
+	}
+	respData, err := f.Request(p, data)
+	if err != nil {
+		return empty, err
+	}
+	err = resp.Unmarshal(respData)
+	if err != nil {
+		return empty, err
+	}
+	return resp, nil
+}
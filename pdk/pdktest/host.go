@@ -0,0 +1,423 @@
+package pdktest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+	"github.com/WuKongIM/wklog"
+	"github.com/WuKongIM/wkrpc"
+	"github.com/WuKongIM/wkrpc/proto"
+	"go.uber.org/zap"
+)
+
+// Host 进程内模拟的WuKongIM服务端，用于插件的单元测试
+//
+// Host在临时目录下监听unix socket，完成插件的 /plugin/start 握手，
+// 可以主动调用插件的 Send、Receive、PersistAfter、Route、ConfigUpdate，
+// 并记录插件发起的所有请求（/message/send、/stream/open 等）。
+type Host struct {
+	opts       *Options
+	dir        string // 临时目录
+	socketPath string
+	rpcServer  *wkrpc.Server
+	wklog.Log
+	*recorder
+
+	mu         sync.RWMutex
+	pluginUid  string                  // 插件连接的uid（插件编号）
+	pluginInfo *pluginproto.PluginInfo // 插件握手时上报的信息
+
+	startedC  chan struct{}
+	startOnce sync.Once
+
+	servingC    chan struct{} // rpc服务已经开始处理连接
+	servingOnce sync.Once
+
+	server    *pdk.Server        // 运行中的插件服务
+	cancelRun context.CancelFunc // 停止运行中的插件
+	runErrC   chan error         // 插件的运行结果
+	closeOnce sync.Once
+}
+
+// initLogOnce wklog 在第一次写日志时才初始化全局日志，
+// 插件和模拟服务端在不同的goroutine中同时初始化会产生数据竞争，创建Host时先在当前goroutine中初始化
+var initLogOnce sync.Once
+
+// NewHost 创建并启动一个模拟的WuKongIM服务端
+func NewHost(opt ...Option) (*Host, error) {
+	opts := applyOptions(opt)
+	// 已经初始化过时不会修改全局日志
+	initLogOnce.Do(func() {
+		wklog.Debug("pdktest host created")
+	})
+
+	dir, err := os.MkdirTemp("", "pdktest")
+	if err != nil {
+		return nil, err
+	}
+	if opts.StartupResp.SandboxDir == "" {
+		opts.StartupResp.SandboxDir = path.Join(dir, "sandbox")
+		if err := os.MkdirAll(opts.StartupResp.SandboxDir, 0755); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	h := &Host{
+		opts:       opts,
+		dir:        dir,
+		socketPath: path.Join(dir, "wukongim.sock"),
+		Log:        wklog.NewWKLog("pdktest.Host"),
+		recorder:   newRecorder(opts.StartupResp.NodeId),
+		startedC:   make(chan struct{}),
+		servingC:   make(chan struct{}),
+	}
+	h.rpcServer = wkrpc.New(fmt.Sprintf("unix://%s", h.socketPath), wkrpc.WithRequestTimeout(opts.RequestTimeout))
+	h.rpcServer.Route("/conn", h.handleConn)
+	h.rpcServer.Route("/plugin/start", h.handleStart)
+	for _, p := range h.paths() {
+		h.route(p)
+	}
+
+	if err := h.rpcServer.Start(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := h.waitServing(); err != nil {
+		h.rpcServer.Stop()
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return h, nil
+}
+
+// waitServing 等待rpc服务开始处理连接
+//
+// wkrpc的Start在gnet启动完成之前返回，插件没有连接就Close时会与启动产生数据竞争，
+// 这里发起一个连接，等待服务端处理了连接请求。
+func (h *Host) waitServing() error {
+	connect, err := (&proto.Connect{Uid: "pdktest"}).Marshal()
+	if err != nil {
+		return err
+	}
+	data, err := proto.New().Encode(connect, proto.MsgTypeConnect)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(h.opts.RequestTimeout)
+	for {
+		conn, err := net.Dial("unix", h.socketPath)
+		if err == nil {
+			defer conn.Close()
+			if _, err := conn.Write(data); err != nil {
+				return err
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-h.servingC:
+		return nil
+	case <-time.After(time.Until(deadline)):
+		return errors.New("wait rpc server timeout")
+	}
+}
+
+// SocketPath 插件需要连接的unix socket路径（配合 pdk.WithSocketPath 使用）
+func (h *Host) SocketPath() string {
+	return h.socketPath
+}
+
+// SandboxDir 握手时下发给插件的沙箱目录
+func (h *Host) SandboxDir() string {
+	return h.opts.StartupResp.SandboxDir
+}
+
+// RunPlugin 在后台运行插件并等待插件就绪，插件在 Close 时停止
+func (h *Host) RunPlugin(constructor func() interface{}, no string, opt ...pdk.Option) error {
+	if constructor == nil {
+		return errors.New("constructor is nil")
+	}
+	return h.Run(pdk.NewFromInstance(constructor(), no), opt...)
+}
+
+// Run 在后台通过 pdk.Run 运行插件，并等待插件就绪（完成握手、应用配置并调用了 Setup），插件在 Close 时停止
+//
+// 插件默认使用 pdktest.Plugin 前缀的日志，不修改 wklog 的全局配置，可以在 go test -race 下运行，
+// 可以通过 pdk.WithLogger 设置插件的日志。
+func (h *Host) Run(p *pdk.Plugin, opt ...pdk.Option) error {
+	if h.runErrC != nil {
+		return errors.New("plugin is already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErrC := make(chan error, 1)
+	readyC := make(chan *pdk.Server, 1)
+
+	opt = append([]pdk.Option{pdk.WithLogger(wklog.NewWKLog("pdktest.Plugin"))}, opt...)
+	opt = append(opt, pdk.WithSocketPath(h.socketPath), pdk.WithOnReady(func(s *pdk.Server) {
+		readyC <- s
+	}))
+	go func() {
+		runErrC <- pdk.Run(ctx, p, opt...)
+	}()
+
+	select {
+	case s := <-readyC:
+		h.mu.Lock()
+		h.server = s
+		h.mu.Unlock()
+		h.cancelRun = cancel
+		h.runErrC = runErrC
+		return nil
+	case err := <-runErrC:
+		cancel()
+		if err == nil {
+			err = errors.New("plugin exited before startup")
+		}
+		return err
+	case <-time.After(h.opts.RequestTimeout):
+		cancel()
+		return errors.New("wait plugin startup timeout")
+	}
+}
+
+// Server 运行中的插件服务，可以配合 pdk.ConfigFrom 获取插件当前的配置，未运行插件时为nil
+func (h *Host) Server() *pdk.Server {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.server
+}
+
+// WaitStarted 等待插件完成握手，返回插件上报的信息
+func (h *Host) WaitStarted(ctx context.Context) (*pluginproto.PluginInfo, error) {
+	select {
+	case <-h.startedC:
+		return h.PluginInfo(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// PluginInfo 插件握手时上报的信息，未握手时为nil
+func (h *Host) PluginInfo() *pluginproto.PluginInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.pluginInfo
+}
+
+// Handle 自定义插件请求某个路径时的响应
+func (h *Host) Handle(p string, handler HandlerFunc) {
+	if !h.setHandler(p, handler) {
+		h.route(p)
+	}
+}
+
+// Send 调用插件的Send方法，返回插件处理后的发送包
+func (h *Host) Send(packet *pluginproto.SendPacket) (*pluginproto.SendPacket, error) {
+	data, err := packet.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	respData, err := h.request("/plugin/send", data)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pluginproto.SendPacket{}
+	err = resp.Unmarshal(respData)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Receive 调用插件的Receive方法（同步请求）
+func (h *Host) Receive(packet *pluginproto.RecvPacket) error {
+	data, err := packet.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = h.request("/plugin/receive", data)
+	return err
+}
+
+// ReceiveAsync 以消息的方式异步调用插件的Receive方法
+func (h *Host) ReceiveAsync(packet *pluginproto.RecvPacket) error {
+	data, err := packet.Marshal()
+	if err != nil {
+		return err
+	}
+	return h.message(pdk.PluginMethodTypeReceive, data)
+}
+
+// PersistAfter 调用插件的PersistAfter方法（同步请求）
+func (h *Host) PersistAfter(messages ...*pluginproto.Message) error {
+	data, err := (&pluginproto.MessageBatch{Messages: messages}).Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = h.request("/plugin/persist_after", data)
+	return err
+}
+
+// PersistAfterAsync 以消息的方式异步调用插件的PersistAfter方法
+func (h *Host) PersistAfterAsync(messages ...*pluginproto.Message) error {
+	data, err := (&pluginproto.MessageBatch{Messages: messages}).Marshal()
+	if err != nil {
+		return err
+	}
+	return h.message(pdk.PluginMethodTypePersistAfter, data)
+}
+
+// Route 请求插件的http路由
+func (h *Host) Route(req *pluginproto.HttpRequest) (*pluginproto.HttpResponse, error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	respData, err := h.request("/plugin/route", data)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pluginproto.HttpResponse{}
+	err = resp.Unmarshal(respData)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ConfigUpdate 更新插件配置
+func (h *Host) ConfigUpdate(cfg map[string]interface{}) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = h.request("/plugin/config_update", data)
+	return err
+}
+
+// StopPlugin 请求插件停止
+func (h *Host) StopPlugin() error {
+	_, err := h.request("/stop", nil)
+	return err
+}
+
+// Close 停止插件（如果是通过 Run 或 RunPlugin 运行的）和模拟服务端，并清理临时目录，可以多次调用
+func (h *Host) Close() {
+	h.closeOnce.Do(func() {
+		if h.runErrC != nil {
+			h.cancelRun()
+			select {
+			case err := <-h.runErrC:
+				if err != nil {
+					h.Warn("plugin exited with error", zap.Error(err))
+				}
+			case <-time.After(h.opts.RequestTimeout):
+				h.Warn("wait plugin exit timeout")
+			}
+			h.runErrC = nil
+		}
+		h.rpcServer.Stop()
+		_ = os.RemoveAll(h.dir)
+	})
+}
+
+func (h *Host) request(p string, data []byte) ([]byte, error) {
+	uid := h.uid()
+	if uid == "" {
+		return nil, errors.New("plugin not started")
+	}
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), h.opts.RequestTimeout)
+	defer cancel()
+
+	resp, err := h.rpcServer.RequestWithContext(timeoutCtx, uid, p, data)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != proto.StatusOK {
+		return nil, fmt.Errorf("status: %d, message: %s", resp.Status, string(resp.Body))
+	}
+	return resp.Body, nil
+}
+
+func (h *Host) message(methodType pdk.PluginMethodType, data []byte) error {
+	uid := h.uid()
+	if uid == "" {
+		return errors.New("plugin not started")
+	}
+	return h.rpcServer.Send(uid, &proto.Message{
+		MsgType: uint32(methodType),
+		Content: data,
+	})
+}
+
+func (h *Host) uid() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.pluginUid
+}
+
+// handleConn 与wkrpc默认的连接处理一样返回成功，并通知服务已经开始处理连接
+func (h *Host) handleConn(c *wkrpc.Context) {
+	c.WriteConnack(&proto.Connack{
+		Id:     c.ConnReq().Id,
+		Status: proto.StatusOK,
+	})
+	h.servingOnce.Do(func() {
+		close(h.servingC)
+	})
+}
+
+func (h *Host) handleStart(c *wkrpc.Context) {
+	body := append([]byte(nil), c.Body()...)
+	h.record("/plugin/start", body)
+
+	info := &pluginproto.PluginInfo{}
+	err := info.Unmarshal(body)
+	if err != nil {
+		h.Error("unmarshal plugin info error", zap.Error(err))
+		c.WriteErr(err)
+		return
+	}
+	h.mu.Lock()
+	h.pluginUid = c.Uid()
+	h.pluginInfo = info
+	h.mu.Unlock()
+
+	data, err := h.opts.StartupResp.Marshal()
+	if err != nil {
+		c.WriteErr(err)
+		return
+	}
+	c.Write(data)
+
+	h.startOnce.Do(func() {
+		close(h.startedC)
+	})
+}
+
+func (h *Host) route(p string) {
+	h.rpcServer.Route(p, func(c *wkrpc.Context) {
+		// 请求对象会被复用，这里需要复制一份
+		body := append([]byte(nil), c.Body()...)
+		data, err := h.handle(p, body)
+		if err != nil {
+			c.WriteErr(err)
+			return
+		}
+		c.Write(data)
+	})
+}
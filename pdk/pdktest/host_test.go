@@ -0,0 +1,122 @@
+package pdktest_test
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+type testConfig struct {
+	Greeting string `json:"greeting" default:"hello"`
+}
+
+func newHost(t *testing.T, opt ...pdktest.Option) *pdktest.Host {
+	t.Helper()
+	host, err := pdktest.NewHost(opt...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(host.Close)
+	return host
+}
+
+func TestHostRun(t *testing.T) {
+	host := newHost(t, pdktest.WithConfig(map[string]interface{}{"greeting": "hi"}))
+	var stopped atomic.Bool
+	p := pdk.New("wk.plugin.test").
+		OnSend(func(c *pdk.Context) {
+			c.SendPacket.Payload = []byte(`{"type":1,"content":"***"}`)
+		}).
+		OnReceive(func(c *pdk.Context) {
+			cfg := pdk.ConfigFrom[testConfig](c.Host())
+			payload, _ := (&pdk.PayloadText{Type: 1, Content: cfg.Greeting}).Encode()
+			c.Reply(payload)
+		}).
+		Routes(func(r *pdk.Route) {
+			r.GET("/hello", func(c *pdk.HttpContext) {
+				c.String(http.StatusOK, pdk.ConfigFrom[testConfig](c.Host()).Greeting)
+			})
+		}).
+		OnStop(func() { stopped.Store(true) }).
+		WithConfig(pdk.TypedConfig[testConfig](nil))
+	if err := host.Run(p, pdk.WithReplySync(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	info := host.PluginInfo()
+	if info.No != "wk.plugin.test" {
+		t.Fatalf("plugin no: %s", info.No)
+	}
+	if cfg := pdk.ConfigFrom[testConfig](host.Server()); cfg.Greeting != "hi" {
+		t.Fatalf("config: %+v", cfg)
+	}
+
+	sent, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1, Payload: []byte(`{"type":1,"content":"bad"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sent.Payload) != `{"type":1,"content":"***"}` {
+		t.Fatalf("send payload: %s", sent.Payload)
+	}
+
+	if err := host.Receive(&pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "bot", ChannelType: 1}); err != nil {
+		t.Fatal(err)
+	}
+	messages := host.SentMessages()
+	if len(messages) != 1 || messages[0].ChannelId != "u1" {
+		t.Fatalf("sent messages: %v", messages)
+	}
+
+	resp, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodGet, Path: "/hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK || string(resp.Body) != "hi" {
+		t.Fatalf("route: %d %s", resp.Status, resp.Body)
+	}
+
+	host.Close()
+	if !stopped.Load() {
+		t.Fatal("plugin was not stopped on close")
+	}
+}
+
+type instancePlugin struct {
+	Config testConfig
+}
+
+func (p *instancePlugin) Route(r *pdk.Route) {
+	r.GET("/hello", func(c *pdk.HttpContext) {
+		c.String(http.StatusOK, pdk.ConfigFrom[testConfig](c.Host()).Greeting)
+	})
+}
+
+func TestHostRunPlugin(t *testing.T) {
+	host := newHost(t)
+	err := host.RunPlugin(func() interface{} { return &instancePlugin{} }, "wk.plugin.instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodGet, Path: "/hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 服务端没有下发配置时使用默认值
+	if string(resp.Body) != "hello" {
+		t.Fatalf("route: %d %s", resp.Status, resp.Body)
+	}
+	if err := host.RunPlugin(func() interface{} { return &instancePlugin{} }, "wk.plugin.instance"); err == nil {
+		t.Fatal("expected an error when running a second plugin")
+	}
+}
+
+func TestHostNotStarted(t *testing.T) {
+	host := newHost(t)
+	if _, err := host.Send(&pluginproto.SendPacket{}); err == nil {
+		t.Fatal("expected an error before the plugin is started")
+	}
+}
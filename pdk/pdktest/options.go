@@ -0,0 +1,86 @@
+package pdktest
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+	"google.golang.org/protobuf/proto"
+)
+
+type Options struct {
+	StartupResp    *pluginproto.StartupResp // 握手(/plugin/start)时返回给插件的数据
+	RequestTimeout time.Duration            // 向插件发起请求的超时时间
+}
+
+func newOptions() *Options {
+	return &Options{
+		StartupResp: &pluginproto.StartupResp{
+			NodeId:  1,
+			Success: true,
+		},
+		RequestTimeout: time.Second * 5,
+	}
+}
+
+func applyOptions(opt []Option) *Options {
+	opts := newOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+	opts.startupResp()
+	return opts
+}
+
+// startupResp 返回握手数据，为nil时创建一个空的
+func (o *Options) startupResp() *pluginproto.StartupResp {
+	if o.StartupResp == nil {
+		o.StartupResp = &pluginproto.StartupResp{}
+	}
+	return o.StartupResp
+}
+
+type Option func(*Options)
+
+// WithStartupResp 自定义握手返回的数据（会复制一份，之后的修改不影响传入的resp）
+func WithStartupResp(resp *pluginproto.StartupResp) Option {
+	return func(o *Options) {
+		if resp == nil {
+			o.StartupResp = nil
+			return
+		}
+		o.StartupResp = proto.Clone(resp).(*pluginproto.StartupResp)
+	}
+}
+
+// WithNodeId 设置握手返回的节点id
+func WithNodeId(nodeId uint64) Option {
+	return func(o *Options) {
+		o.startupResp().NodeId = nodeId
+	}
+}
+
+// WithSandboxDir 设置握手返回的沙箱目录（默认为临时目录）
+func WithSandboxDir(dir string) Option {
+	return func(o *Options) {
+		o.startupResp().SandboxDir = dir
+	}
+}
+
+// WithConfig 设置握手时下发给插件的配置
+func WithConfig(cfg map[string]interface{}) Option {
+	return func(o *Options) {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			panic(err)
+		}
+		o.startupResp().Config = data
+	}
+}
+
+// WithRequestTimeout 设置向插件发起请求的超时时间
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.RequestTimeout = timeout
+	}
+}
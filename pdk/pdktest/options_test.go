@@ -0,0 +1,44 @@
+package pdktest_test
+
+import (
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func TestWithStartupRespNil(t *testing.T) {
+	host := pdktest.NewFakeHost(
+		pdktest.WithStartupResp(nil),
+		pdktest.WithNodeId(3),
+		pdktest.WithSandboxDir("/tmp/sandbox"),
+		pdktest.WithConfig(map[string]interface{}{"a": 1}),
+	)
+	if host.NodeId() != 3 {
+		t.Fatalf("node id: %d", host.NodeId())
+	}
+	if host.SandboxDir() != "/tmp/sandbox" {
+		t.Fatalf("sandbox dir: %s", host.SandboxDir())
+	}
+
+	host = pdktest.NewFakeHost(pdktest.WithStartupResp(nil))
+	if host.NodeId() != 0 {
+		t.Fatalf("node id: %d", host.NodeId())
+	}
+}
+
+func TestWithStartupRespCopied(t *testing.T) {
+	resp := &pluginproto.StartupResp{NodeId: 2, Success: true, SandboxDir: "/tmp/a"}
+	host := pdktest.NewFakeHost(pdktest.WithStartupResp(resp), pdktest.WithNodeId(5), pdktest.WithSandboxDir("/tmp/b"))
+	if host.NodeId() != 5 || host.SandboxDir() != "/tmp/b" {
+		t.Fatalf("host: %d %s", host.NodeId(), host.SandboxDir())
+	}
+	if resp.NodeId != 2 || resp.SandboxDir != "/tmp/a" {
+		t.Fatalf("shared resp mutated: %d %s", resp.NodeId, resp.SandboxDir)
+	}
+
+	other := pdktest.NewFakeHost(pdktest.WithStartupResp(resp))
+	if other.NodeId() != 2 || other.SandboxDir() != "/tmp/a" {
+		t.Fatalf("other host: %d %s", other.NodeId(), other.SandboxDir())
+	}
+}
@@ -0,0 +1,203 @@
+package pdktest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// HandlerFunc 处理插件发起的请求，返回给插件的响应数据
+type HandlerFunc func(body []byte) ([]byte, error)
+
+// Call 插件发起的一次请求
+type Call struct {
+	Path string // 请求路径
+	Body []byte // 请求内容
+}
+
+// Unmarshal 将请求内容解码到pluginproto的请求对象中
+func (c *Call) Unmarshal(v interface{ Unmarshal([]byte) error }) error {
+	return v.Unmarshal(c.Body)
+}
+
+// recorder 记录插件发起的请求，并按路径返回响应（Host和FakeHost共用）
+type recorder struct {
+	mu       sync.RWMutex
+	calls    []*Call
+	handlers map[string]HandlerFunc
+	idGen    atomic.Int64 // 消息id、流编号生成
+	nodeId   uint64
+}
+
+func newRecorder(nodeId uint64) *recorder {
+	r := &recorder{
+		nodeId: nodeId,
+	}
+	r.handlers = r.defaultHandlers()
+	return r
+}
+
+func (r *recorder) record(p string, body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, &Call{
+		Path: p,
+		Body: body,
+	})
+}
+
+// handle 记录请求并返回响应
+func (r *recorder) handle(p string, body []byte) ([]byte, error) {
+	r.record(p, body)
+
+	r.mu.RLock()
+	handler := r.handlers[p]
+	r.mu.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("route not found: %s", p)
+	}
+	return handler(body)
+}
+
+// setHandler 设置路径的处理函数，返回之前是否已存在
+func (r *recorder) setHandler(p string, handler HandlerFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, exist := r.handlers[p]
+	r.handlers[p] = handler
+	return exist
+}
+
+func (r *recorder) paths() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	paths := make([]string, 0, len(r.handlers))
+	for p := range r.handlers {
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func (r *recorder) nextId() int64 {
+	return r.idGen.Add(1)
+}
+
+// Calls 插件发起的请求记录，指定paths时只返回这些路径的请求
+func (r *recorder) Calls(paths ...string) []*Call {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	calls := make([]*Call, 0, len(r.calls))
+	for _, c := range r.calls {
+		if len(paths) == 0 || contains(paths, c.Path) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset 清空请求记录
+func (r *recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// SentMessages 插件通过 /message/send 发送的消息
+func (r *recorder) SentMessages() []*pluginproto.SendReq {
+	return decodeCalls(r.Calls("/message/send"), func() *pluginproto.SendReq { return &pluginproto.SendReq{} })
+}
+
+// OpenedStreams 插件通过 /stream/open 打开的流
+func (r *recorder) OpenedStreams() []*pluginproto.Stream {
+	return decodeCalls(r.Calls("/stream/open"), func() *pluginproto.Stream { return &pluginproto.Stream{} })
+}
+
+// StreamWrites 插件通过 /stream/write 写入的流数据
+func (r *recorder) StreamWrites() []*pluginproto.StreamWriteReq {
+	return decodeCalls(r.Calls("/stream/write"), func() *pluginproto.StreamWriteReq { return &pluginproto.StreamWriteReq{} })
+}
+
+// ClosedStreams 插件通过 /stream/close 关闭的流
+func (r *recorder) ClosedStreams() []*pluginproto.StreamCloseReq {
+	return decodeCalls(r.Calls("/stream/close"), func() *pluginproto.StreamCloseReq { return &pluginproto.StreamCloseReq{} })
+}
+
+func decodeCalls[T interface{ Unmarshal([]byte) error }](calls []*Call, newFn func() T) []T {
+	results := make([]T, 0, len(calls))
+	for _, c := range calls {
+		v := newFn()
+		if err := c.Unmarshal(v); err != nil {
+			panic(fmt.Errorf("unmarshal %s error: %w", c.Path, err))
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+func contains(paths []string, p string) bool {
+	for _, pth := range paths {
+		if pth == p {
+			return true
+		}
+	}
+	return false
+}
+
+// 插件请求的默认响应
+func (r *recorder) defaultHandlers() map[string]HandlerFunc {
+	return map[string]HandlerFunc{
+		"/message/send": func(body []byte) ([]byte, error) {
+			return (&pluginproto.SendResp{MessageId: r.nextId()}).Marshal()
+		},
+		"/stream/open": func(body []byte) ([]byte, error) {
+			return (&pluginproto.StreamOpenResp{StreamNo: fmt.Sprintf("stream%d", r.nextId())}).Marshal()
+		},
+		"/stream/write": func(body []byte) ([]byte, error) {
+			req := &pluginproto.StreamWriteReq{}
+			if err := req.Unmarshal(body); err != nil {
+				return nil, err
+			}
+			return (&pluginproto.StreamWriteResp{MessageId: r.nextId(), ClientMsgNo: req.ClientMsgNo}).Marshal()
+		},
+		"/stream/close": func(body []byte) ([]byte, error) {
+			return nil, nil
+		},
+		"/channel/messages": func(body []byte) ([]byte, error) {
+			req := &pluginproto.ChannelMessageBatchReq{}
+			if err := req.Unmarshal(body); err != nil {
+				return nil, err
+			}
+			resp := &pluginproto.ChannelMessageBatchResp{}
+			for _, msgReq := range req.ChannelMessageReqs {
+				resp.ChannelMessageResps = append(resp.ChannelMessageResps, &pluginproto.ChannelMessageResp{
+					ChannelId:       msgReq.ChannelId,
+					ChannelType:     msgReq.ChannelType,
+					StartMessageSeq: msgReq.StartMessageSeq,
+					Limit:           msgReq.Limit,
+				})
+			}
+			return resp.Marshal()
+		},
+		"/conversation/channels": func(body []byte) ([]byte, error) {
+			return (&pluginproto.ConversationChannelResp{}).Marshal()
+		},
+		"/cluster/channels/belongNode": func(body []byte) ([]byte, error) {
+			req := &pluginproto.ClusterChannelBelongNodeReq{}
+			if err := req.Unmarshal(body); err != nil {
+				return nil, err
+			}
+			return (&pluginproto.ClusterChannelBelongNodeBatchResp{
+				ClusterChannelBelongNodeResps: []*pluginproto.ClusterChannelBelongNodeResp{
+					{NodeId: r.nodeId, Channels: req.Channels},
+				},
+			}).Marshal()
+		},
+		"/plugin/httpForward": func(body []byte) ([]byte, error) {
+			return (&pluginproto.HttpResponse{Status: 200}).Marshal()
+		},
+	}
+}
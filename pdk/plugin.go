@@ -2,13 +2,13 @@ package pdk
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
@@ -59,64 +59,56 @@ func (p PluginMethod) Type() PluginMethodType {
 }
 
 type plugin struct {
-	constructor         func() interface{}
 	opts                *Options
 	rpcClient           *client.Client
 	methods             []string
-	handlers            map[string]func(*Context)
-	routeHandler        func(*Route)
+	chains              map[string][]HookHandler // 钩子的处理链（中间件 + 处理函数）
 	stopHandler         func()
 	setupHandler        func()
 	configUpdateHandler func()
-	sandbox             string // 沙箱目录
-	r                   *Route // http 路由
+	hostHandler         func(HostAPI)
+	readyHandler        func()    // 启动完成后的回调
+	modules             []*Module // 插件模块
+	sandbox             string    // 沙箱目录
+	r                   *Route    // http 路由
 	wklog.Log
 	setupOnce    sync.Once
 	serverNodeId uint64                      // 服务节点id
 	cfgTemplate  *pluginproto.ConfigTemplate // 插件配置模版
-	configType   reflect.Type                // 配置对象的类型
-	instance     interface{}
-}
+	configs      []*configSlot               // 插件自身和各模块的配置
+	configMu     sync.Mutex                  // 保证配置按顺序更新
+	configFrozen bool                        // 已调用 Setup，不再写入插件实例的 Config 字段（实现了 ConfigUpdate() 的除外），需要持有 configMu
+	instance     interface{}                 // RunServer 的插件实例
 
-func newPlugin(opts *Options, constructor func() interface{}, rpcClient *client.Client) *plugin {
+	recoveredPanics atomic.Uint64 // 已恢复的panic数量
+}
 
-	instance := constructor()
-	t := reflect.TypeOf(instance)
+func newPlugin(opts *Options, def *Plugin, rpcClient *client.Client) *plugin {
 
-	configType := getPluginConfigTemplateType(t)
+	modules := opts.modules
 
-	// 获取路由处理函数
-	routeHandler := getRouteHandler(instance)
-	var r *Route
-	if routeHandler != nil {
-		r = newRoute()
-		routeHandler(r)
+	chains := map[string][]HookHandler{}
+	for _, method := range []PluginMethod{PluginSend, PluginPersistAfter, PluginReceive} {
+		if chain := buildHookChain(opts.middlewares, method, hookHandlers(def, modules, method)...); chain != nil {
+			chains[method.String()] = chain
+		}
 	}
 
-	// 获取停止处理函数
-	stopHandler := getStopHandler(instance)
-
-	// setup handler
-	setupHandler := getSetupHandler(instance)
-
-	// config update handler
-	configUpdateHandler := getConfigUpdateHandler(instance)
-
 	pg := &plugin{
-		constructor:         constructor,
 		opts:                opts,
 		rpcClient:           rpcClient,
-		methods:             getHandlerNames(t),
-		handlers:            getHandlers(instance),
-		routeHandler:        routeHandler,
-		stopHandler:         stopHandler,
-		setupHandler:        setupHandler,
-		r:                   r,
-		Log:                 wklog.NewWKLog(fmt.Sprintf("Plugin[%s]", opts.No)),
-		cfgTemplate:         getPluginConfigTemplate(configType),
-		configType:          configType,
-		configUpdateHandler: configUpdateHandler,
-		instance:            instance,
+		methods:             pluginMethods(def, modules),
+		chains:              chains,
+		stopHandler:         def.stop,
+		setupHandler:        def.setup,
+		r:                   buildRoute(def, modules),
+		Log:                 newLogger(opts, fmt.Sprintf("Plugin[%s]", opts.No)),
+		configUpdateHandler: def.legacyConfigUpdate,
+		hostHandler:         def.host,
+		modules:             modules,
+		configs:             configSlots(def, modules),
+		cfgTemplate:         configTemplate(def, modules),
+		instance:            def.instance,
 	}
 	if strings.TrimSpace(opts.Sandbox) != "" {
 		pg.sandbox = opts.Sandbox
@@ -125,39 +117,70 @@ func newPlugin(opts *Options, constructor func() interface{}, rpcClient *client.
 	return pg
 }
 
+// start 注册连接回调，每次连接（包括重连）上服务端后发送插件信息，第一次连接后调用 Setup
+//
+// 需要在rpc客户端启动之前调用。
 func (p *plugin) start() {
-	if p.rpcClient.IsAuthed() {
-		_ = p.requestStart()
-
-		p.setupOnce.Do(func() {
-			p.initLogger()
-			if p.setupHandler != nil {
-				p.setupHandler()
-			}
-		})
-	}
-
 	p.rpcClient.OnConnectChanged(func(status client.ConnStatus) {
 		if status == client.Authed {
-			_ = p.requestStart()
-			p.setupOnce.Do(func() {
-				p.initLogger()
-				if p.setupHandler != nil {
-					p.setupHandler()
-				}
-			})
+			if err := p.requestStart(); err != nil {
+				p.Error("plugin start error", zap.Error(err))
+			}
+			p.setupOnce.Do(p.setup)
 		}
 	})
+}
+
+// setup 第一次连接上服务端后初始化日志，按注册顺序调用插件和各模块的 Setup，然后通知插件已就绪
+func (p *plugin) setup() {
+	// Setup 之后钩子可能并发读取 Config 字段，除实现了 ConfigUpdate() 的插件外不再写入
+	p.configMu.Lock()
+	p.configFrozen = true
+	p.configMu.Unlock()
+
+	p.initLogger()
+	if p.setupHandler != nil {
+		p.setupHandler()
+	}
+	for _, m := range p.modules {
+		if m.setup != nil {
+			m.setup()
+		}
+	}
+	if p.readyHandler != nil {
+		p.readyHandler()
+	}
+}
 
+// 将服务端接口注入到插件实例和各模块
+func (p *plugin) setHost(host HostAPI) {
+	if p.hostHandler != nil {
+		p.hostHandler(host)
+	}
+	for _, m := range p.modules {
+		if m.host != nil {
+			m.host(host)
+		}
+	}
 }
 
+// stop 按注册的相反顺序停止各模块，最后停止插件
 func (p *plugin) stop() {
+	for i := len(p.modules) - 1; i >= 0; i-- {
+		if stop := p.modules[i].stop; stop != nil {
+			stop()
+		}
+	}
 	if p.stopHandler != nil {
 		p.stopHandler()
 	}
 }
 
+// initLogger 将 wklog 的全局日志写入沙箱目录，通过 WithLogger 设置了日志时不修改全局配置
 func (p *plugin) initLogger() {
+	if p.opts.Logger != nil {
+		return
+	}
 	// 初始化日志目录
 	opts := wklog.NewOptions()
 	opts.LogDir = path.Join(p.sandbox, "logs")
@@ -165,24 +188,23 @@ func (p *plugin) initLogger() {
 }
 
 func (p *plugin) send(ctx *Context) {
-	handler := p.handlers[PluginSend.String()]
-	if handler != nil {
-		handler(ctx)
-	}
+	p.handleHook(PluginSend, ctx)
 }
 
 func (p *plugin) receive(ctx *Context) {
-	handler := p.handlers[PluginReceive.String()]
-	if handler != nil {
-		handler(ctx)
-	}
+	p.handleHook(PluginReceive, ctx)
 }
 
 func (p *plugin) persistAfter(ctx *Context) {
-	handler := p.handlers[PluginPersistAfter.String()]
-	if handler != nil {
-		handler(ctx)
+	p.handleHook(PluginPersistAfter, ctx)
+}
+
+func (p *plugin) handleHook(method PluginMethod, ctx *Context) {
+	chain := p.chains[method.String()]
+	if len(chain) == 0 {
+		return
 	}
+	ctx.run(method, chain)
 }
 
 func (p *plugin) route(ctx *HttpContext) {
@@ -193,60 +215,127 @@ func (p *plugin) route(ctx *HttpContext) {
 	p.r.handle(ctx)
 }
 
-func (p *plugin) configUpdate(cfg map[string]interface{}) {
-	if p.configType == nil {
-		return
+// configUpdate 应用新的配置，配置无效时返回 *ConfigError 并保留旧的配置
+//
+// 各模块的配置位于以模块名为key的对象中，其余的key属于插件自身的配置。
+// 插件和所有模块的配置都有效时才会一起应用。strict 为false时忽略未知的字段，见 fillConfig。
+func (p *plugin) configUpdate(cfg map[string]interface{}, strict bool) error {
+	if len(p.configs) == 0 {
+		return nil
+	}
+
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+
+	// 将map配置填充到各自的配置结构体中
+	configs := make([]reflect.Value, len(p.configs))
+	var errs FieldErrors
+	var ignored []string
+	for i, slot := range p.configs {
+		section, fieldErr := p.configSection(cfg, slot.name)
+		if fieldErr != nil {
+			errs = append(errs, fieldErr)
+			continue
+		}
+		configs[i] = reflect.New(slot.typ)
+		fieldIgnored, err := fillConfig(section, configs[i].Interface(), strict)
+		if err != nil {
+			errs = append(errs, prefixConfigErrors(err, slot.name)...)
+		}
+		for _, field := range fieldIgnored {
+			if slot.name != "" {
+				field = slot.name + "." + field
+			}
+			ignored = append(ignored, field)
+		}
 	}
-
-	// 将map配置填充到Config结构体中
-	config := reflect.New(p.configType).Interface()
-	err := fillConfig(cfg, config)
-	if err != nil {
+	if len(ignored) > 0 {
+		p.Warn("unknown config fields are ignored", zap.Strings("fields", ignored))
+	}
+	if len(errs) > 0 {
+		err := &ConfigError{Errors: errs}
 		p.Error("fill config error", zap.Error(err))
-		return
+		return err
 	}
 
-	// 设置Config
-	v := reflect.ValueOf(p.instance).Elem()
-	cfgValue := v.FieldByName("Config")
-	if !cfgValue.IsValid() {
-		p.Warn("config field not found")
-		return
-	}
-	cfgValue.Set(reflect.ValueOf(config).Elem())
+	for i, slot := range p.configs {
+		// 保存配置快照，快照保存后不会再被修改
+		config := configs[i]
+		old := slot.load()
+		slot.value.Store(config.Interface())
+
+		// 设置Config（兼容在 Setup 中读取Config字段的插件），只在 Setup 之前写入，之后的配置更新通过 pdk.Config 读取；
+		// 实现了 ConfigUpdate() 的插件在回调中读取Config字段，每次更新都写入
+		if slot.name == "" && p.instance != nil && (!p.configFrozen || p.configUpdateHandler != nil) {
+			cfgValue := reflect.ValueOf(p.instance).Elem().FieldByName("Config")
+			if cfgValue.IsValid() {
+				cfgValue.Set(config.Elem())
+			} else {
+				p.Warn("config field not found")
+			}
+		}
 
-	// 通知插件
+		// 通知插件或模块
+		if slot.onUpdate != nil {
+			oldValue := reflect.Zero(slot.typ)
+			if old != nil {
+				oldValue = reflect.ValueOf(old).Elem()
+			}
+			slot.onUpdate(oldValue, config.Elem())
+		}
+	}
 	if p.configUpdateHandler != nil {
 		p.configUpdateHandler()
 	}
-
+	return nil
 }
 
-// fillConfig 将 cfg map 类型的数据填充到 config 结构体中
-func fillConfig(cfg map[string]interface{}, config interface{}) error {
-	v := reflect.ValueOf(config).Elem()
-	t := v.Type()
-
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		jsonTag := field.Tag.Get("json")
-		if jsonTag == "" {
-			jsonTag = field.Name
+// configSection 插件自身（name为空）或模块的配置
+func (p *plugin) configSection(cfg map[string]interface{}, name string) (map[string]interface{}, *FieldError) {
+	if name != "" {
+		value, ok := cfg[name]
+		if !ok || value == nil {
+			return nil, nil
+		}
+		section, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, &FieldError{Field: name, Message: fmt.Sprintf("cannot convert %s to object", jsonKind(value))}
+		}
+		return section, nil
+	}
+	if len(p.modules) == 0 {
+		return cfg, nil
+	}
+	section := make(map[string]interface{}, len(cfg))
+	for key, value := range cfg {
+		section[key] = value
+	}
+	for _, m := range p.modules {
+		if m.config != nil {
+			delete(section, m.name)
 		}
+	}
+	return section, nil
+}
 
-		if value, ok := cfg[jsonTag]; ok {
-			fieldValue := v.Field(i)
-			if fieldValue.CanSet() {
-				val := reflect.ValueOf(value)
-				if val.Type().ConvertibleTo(fieldValue.Type()) {
-					fieldValue.Set(val.Convert(fieldValue.Type()))
-				} else {
-					return fmt.Errorf("cannot convert %v to %v", val.Type(), fieldValue.Type())
-				}
-			}
+// prefixConfigErrors 将模块配置的字段错误加上模块名前缀
+func prefixConfigErrors(err error, name string) FieldErrors {
+	cfgErr, ok := err.(*ConfigError)
+	if !ok {
+		return FieldErrors{{Field: name, Message: err.Error()}}
+	}
+	if name == "" {
+		return cfgErr.Errors
+	}
+	errs := make(FieldErrors, 0, len(cfgErr.Errors))
+	for _, fe := range cfgErr.Errors {
+		field := name
+		if fe.Field != "" {
+			field = name + "." + fe.Field
 		}
+		errs = append(errs, &FieldError{Field: field, Message: fe.Message})
 	}
-	return nil
+	return errs
 }
 
 func (p *plugin) requestStart() error {
@@ -270,15 +359,25 @@ func (p *plugin) requestStart() error {
 	}
 	p.sandbox = resp.SandboxDir
 	p.serverNodeId = resp.NodeId
+	var config map[string]interface{}
 	if len(resp.Config) > 0 {
-		var config map[string]interface{}
-		err = json.Unmarshal(resp.Config, &config)
+		config, err = decodeConfig(resp.Config)
 		if err != nil {
-			p.Warn("unmarshal config error", zap.Error(err))
-		} else {
-			p.configUpdate(config)
+			p.Error("unmarshal config error, use the default config", zap.Error(err))
+			config = nil
 		}
 	}
+	var updateErr error
+	err = p.safeCall(PluginConfigUpdate, nil, func() {
+		// 服务端保存的配置可能包含插件升级后删除的字段，启动时忽略未知的字段
+		updateErr = p.applyConfig(config, false)
+	})
+	if err != nil {
+		return err
+	}
+	if updateErr != nil {
+		return updateErr
+	}
 	return nil
 }
 
@@ -314,6 +413,22 @@ func (p *plugin) getPluginInfo() *pluginproto.PluginInfo {
 
 }
 
+// configTemplate 插件自身和各模块的配置模版，模块的配置为以模块名命名的对象字段
+func configTemplate(def *Plugin, modules []*Module) *pluginproto.ConfigTemplate {
+	var template *pluginproto.ConfigTemplate
+	if def.config != nil {
+		template = getPluginConfigTemplate(def.config.typ)
+	} else {
+		template = getPluginConfigTemplate(nil)
+	}
+	for _, m := range modules {
+		if m.config != nil {
+			template.Fields = append(template.Fields, moduleConfigField(m.name, m.config.typ))
+		}
+	}
+	return template
+}
+
 func getPluginConfigTemplate(configType reflect.Type) *pluginproto.ConfigTemplate {
 	if configType == nil {
 		return &pluginproto.ConfigTemplate{}
@@ -339,54 +454,6 @@ func getPluginConfigTemplateType(t reflect.Type) reflect.Type {
 
 }
 
-func getFields(t reflect.Type) []*pluginproto.Field {
-	fields := []*pluginproto.Field{}
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		// ignore unexported fields
-		if len(field.PkgPath) != 0 {
-			continue
-		}
-
-		name := field.Tag.Get("json")
-		label := field.Tag.Get("label")
-		fieldType := getFieldType(field.Type)
-		if fieldType == "" {
-			continue
-		}
-
-		if label == "" {
-			label = name
-		}
-
-		fields = append(fields, &pluginproto.Field{
-			Name:  name,
-			Label: label,
-			Type:  fieldType,
-		})
-	}
-	return fields
-}
-
-func getFieldType(t reflect.Type) string {
-	if t == reflect.TypeOf(SecretKey("")) {
-		return "secret"
-	}
-	switch t.Kind() {
-	case reflect.String:
-		return "string"
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return "number"
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return "number"
-	case reflect.Float32, reflect.Float64:
-		return "number"
-	case reflect.Bool:
-		return "bool"
-	}
-	return ""
-}
-
 // 获取插件名称
 func getName() (string, error) {
 	execPath, err := os.Executable()
@@ -397,65 +464,92 @@ func getName() (string, error) {
 	return name, nil
 }
 
-var methodNames = [...]string{
-	PluginSend.String(),
-	PluginPersistAfter.String(),
-	PluginReceive.String(),
-	PluginRoute.String(),
-}
-
-func getHandlerNames(t reflect.Type) []string {
-	handlers := []string{}
-	for _, name := range methodNames {
-		_, hasIt := t.MethodByName(name)
-		if hasIt {
-			handlers = append(handlers, name)
+// NewFromInstance 通过反射从插件实例中获取钩子、路由和配置，与 RunServer 的规则相同，可以配合 Run 使用
+//
+// 插件实例通过实现 Send、Receive、Route 等方法注册钩子，配置为名为 Config 的字段。
+// 实现了 ConfigUpdate() 的插件每次配置更新都会先写入 Config 字段再调用 ConfigUpdate（与之前的行为一致），
+// 在钩子中并发读取 Config 字段是不安全的；其他插件的 Config 字段只在调用 Setup 之前写入，
+// 之后通过 pdk.ConfigFrom 读取当前配置的快照，或实现 ConfigUpdate(old, new T)。
+func NewFromInstance(instance interface{}, no string) *Plugin {
+	p := New(no)
+	p.instance = instance
+	for method, handler := range getHandlers(instance) {
+		p.hooks[method] = handler
+	}
+	if h, ok := instance.(route); ok {
+		p.routes = h.Route
+	}
+	if h, ok := instance.(stop); ok {
+		p.stop = h.Stop
+	}
+	if h, ok := instance.(setup); ok {
+		p.setup = h.Setup
+	}
+	if h, ok := instance.(hostSetter); ok {
+		p.host = h.SetHost
+	}
+	if configType := getPluginConfigTemplateType(reflect.TypeOf(instance)); configType != nil {
+		p.config = &ConfigBinding{typ: configType}
+		if h, ok := instance.(configUpdate); ok {
+			p.legacyConfigUpdate = h.ConfigUpdate
+		} else {
+			p.config.onUpdate = getConfigChangeHandler(instance, configType)
 		}
 	}
-	return handlers
+	return p
 }
 
-func getHandlers(instance interface{}) map[string]func(*Context) {
-	handlers := map[string]func(*Context){}
+func getHandlers(instance interface{}) map[PluginMethod]func(*Context) {
+	handlers := map[PluginMethod]func(*Context){}
 
 	if h, ok := instance.(send); ok {
-		handlers[PluginSend.String()] = h.Send
+		handlers[PluginSend] = h.Send
 	}
 	if h, ok := instance.(persistAfter); ok {
-		handlers[PluginPersistAfter.String()] = h.PersistAfter
+		handlers[PluginPersistAfter] = h.PersistAfter
 	}
 	if h, ok := instance.(receive); ok {
-		handlers[PluginReceive.String()] = h.Receive
+		handlers[PluginReceive] = h.Receive
 	}
-	return handlers
-}
 
-func getRouteHandler(instance interface{}) func(*Route) {
-	if h, ok := instance.(route); ok {
-		return h.Route
+	// 同时实现了两个版本时，以返回错误的版本为准
+	if h, ok := instance.(sendE); ok {
+		handlers[PluginSend] = hookHandlerE(h.SendE)
 	}
-	return nil
-}
-
-func getStopHandler(instance interface{}) func() {
-	if h, ok := instance.(stop); ok {
-		return h.Stop
+	if h, ok := instance.(persistAfterE); ok {
+		handlers[PluginPersistAfter] = hookHandlerE(h.PersistAfterE)
 	}
-	return nil
+	if h, ok := instance.(receiveE); ok {
+		handlers[PluginReceive] = hookHandlerE(h.ReceiveE)
+	}
+	return handlers
 }
 
-func getSetupHandler(instance interface{}) func() {
-	if h, ok := instance.(setup); ok {
-		return h.Setup
+// hookHandlerE 将返回错误的处理函数转换为普通的处理函数，错误记录到上下文中返回给服务端
+func hookHandlerE(handler func(*Context) error) func(*Context) {
+	return func(c *Context) {
+		if err := handler(c); err != nil {
+			c.AbortWithError(err)
+		}
 	}
-	return nil
 }
 
-func getConfigUpdateHandler(instance interface{}) func() {
-	if h, ok := instance.(configUpdate); ok {
-		return h.ConfigUpdate
+// getConfigChangeHandler 获取 ConfigUpdate(old, new T) 方法，T 为插件的配置类型
+func getConfigChangeHandler(instance interface{}, configType reflect.Type) func(old, new reflect.Value) {
+	if configType == nil {
+		return nil
+	}
+	method := reflect.ValueOf(instance).MethodByName("ConfigUpdate")
+	if !method.IsValid() {
+		return nil
+	}
+	mt := method.Type()
+	if mt.NumIn() != 2 || mt.NumOut() != 0 || mt.In(0) != configType || mt.In(1) != configType {
+		return nil
+	}
+	return func(old, new reflect.Value) {
+		method.Call([]reflect.Value{old, new})
 	}
-	return nil
 }
 
 type (
@@ -470,6 +564,18 @@ type (
 		Receive(*Context)
 	}
 
+	sendE interface {
+		SendE(*Context) error
+	}
+
+	persistAfterE interface {
+		PersistAfterE(*Context) error
+	}
+
+	receiveE interface {
+		ReceiveE(*Context) error
+	}
+
 	route interface {
 		Route(*Route)
 	}
@@ -485,4 +591,8 @@ type (
 	configUpdate interface {
 		ConfigUpdate()
 	}
+
+	hostSetter interface {
+		SetHost(HostAPI)
+	}
 )
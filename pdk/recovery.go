@@ -0,0 +1,82 @@
+package pdk
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+	"go.uber.org/zap"
+)
+
+// SendPanicPolicy Send钩子发生panic时的处理策略
+type SendPanicPolicy int
+
+const (
+	// SendFailClosed 返回错误给服务端，消息不会被发送（默认）
+	SendFailClosed SendPanicPolicy = iota
+	// SendFailOpen 忽略插件的修改，按原始的发送包放行消息
+	SendFailOpen
+)
+
+// PanicError 插件钩子发生panic时返回给服务端的错误
+type PanicError struct {
+	Method PluginMethod // 发生panic的钩子
+	Value  interface{}  // panic的值
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("plugin %s panic: %v", e.Method, e.Value)
+}
+
+// safeCall 执行fn，恢复fn中发生的panic并以PanicError返回
+func (p *plugin) safeCall(method PluginMethod, fields []zap.Field, fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.recoveredPanics.Add(1)
+			fields = append(fields,
+				zap.String("pluginNo", p.opts.No),
+				zap.String("method", method.String()),
+				zap.Any("panic", r),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			p.Error("plugin panic recovered", fields...)
+			err = &PanicError{Method: method, Value: r}
+		}
+	}()
+	fn()
+	return nil
+}
+
+func sendPacketFields(sendPacket *pluginproto.SendPacket) []zap.Field {
+	return []zap.Field{
+		zap.String("fromUid", sendPacket.FromUid),
+		zap.String("channelId", sendPacket.ChannelId),
+		zap.Uint32("channelType", sendPacket.ChannelType),
+	}
+}
+
+func recvPacketFields(recvPacket *pluginproto.RecvPacket) []zap.Field {
+	return []zap.Field{
+		zap.String("fromUid", recvPacket.FromUid),
+		zap.String("toUid", recvPacket.ToUid),
+		zap.String("channelId", recvPacket.ChannelId),
+		zap.Uint32("channelType", recvPacket.ChannelType),
+	}
+}
+
+func messagesFields(messages []*pluginproto.Message) []zap.Field {
+	messageIds := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		messageIds = append(messageIds, m.MessageId)
+	}
+	return []zap.Field{
+		zap.Int64s("messageIds", messageIds),
+	}
+}
+
+func httpRequestFields(req *pluginproto.HttpRequest) []zap.Field {
+	return []zap.Field{
+		zap.String("httpMethod", req.Method),
+		zap.String("path", req.Path),
+	}
+}
@@ -0,0 +1,92 @@
+package pdk_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func runPanicPlugin(t *testing.T, opt ...pdk.Option) *pdktest.Host {
+	t.Helper()
+	host, err := pdktest.NewHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(host.Close)
+	p := pdk.New("wk.plugin.panic").
+		OnSend(func(c *pdk.Context) {
+			c.SendPacket.Payload = []byte("modified")
+			c.SendPacket.ChannelId = "other"
+			panic("send boom")
+		}).
+		OnReceive(func(c *pdk.Context) {
+			panic("receive boom")
+		}).
+		Routes(func(r *pdk.Route) {
+			r.GET("/panic", func(c *pdk.HttpContext) {
+				panic("route boom")
+			})
+		})
+	if err := host.Run(p, opt...); err != nil {
+		t.Fatal(err)
+	}
+	return host
+}
+
+func TestSendPanicFailClosed(t *testing.T) {
+	host := runPanicPlugin(t)
+	_, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1, Payload: []byte("original")})
+	if err == nil {
+		t.Fatal("expected an error when Send panics")
+	}
+	if !strings.Contains(err.Error(), "send boom") {
+		t.Fatalf("error: %v", err)
+	}
+	if n := host.Server().RecoveredPanics(); n != 1 {
+		t.Fatalf("recovered panics: %d", n)
+	}
+}
+
+func TestSendPanicFailOpen(t *testing.T) {
+	host := runPanicPlugin(t, pdk.WithSendPanicPolicy(pdk.SendFailOpen))
+	packet := &pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1, Payload: []byte("original")}
+	sent, err := host.Send(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 插件在panic前对发送包的修改不会生效
+	if sent.FromUid != packet.FromUid || sent.ChannelId != packet.ChannelId || sent.ChannelType != packet.ChannelType || string(sent.Payload) != "original" {
+		t.Fatalf("sent packet: %v", sent)
+	}
+	if n := host.Server().RecoveredPanics(); n != 1 {
+		t.Fatalf("recovered panics: %d", n)
+	}
+}
+
+func TestRecoveredPanicsCount(t *testing.T) {
+	host := runPanicPlugin(t)
+	if n := host.Server().RecoveredPanics(); n != 0 {
+		t.Fatalf("recovered panics: %d", n)
+	}
+	if err := host.Receive(&pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "bot", ChannelType: 1}); err == nil {
+		t.Fatal("expected an error when Receive panics")
+	}
+	if _, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodGet, Path: "/panic"}); err == nil {
+		t.Fatal("expected an error when the route panics")
+	}
+	if _, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1}); err == nil {
+		t.Fatal("expected an error when Send panics")
+	}
+	if n := host.Server().RecoveredPanics(); n != 3 {
+		t.Fatalf("recovered panics: %d", n)
+	}
+
+	// panic被恢复后插件继续处理请求
+	if _, err := host.Route(&pluginproto.HttpRequest{Method: http.MethodGet, Path: "/missing"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,63 +2,254 @@ package pdk
 
 import (
 	"net/http"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 )
 
 type Route struct {
-	postLock sync.RWMutex
-	postMap  map[string]Handler
+	*RouterGroup
 
-	getLock sync.RWMutex
-	getMap  map[string]Handler
+	lock     sync.RWMutex
+	trees    map[string]*node // 每个请求方法一棵路由树
+	noRoute  []Handler        // 路由不存在时的处理函数
+	noMethod []Handler        // 路由存在但请求方法不匹配时的处理函数
+}
+
+// anyMethods Any 注册的请求方法
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodConnect,
+	http.MethodTrace,
 }
 
 func newRoute() *Route {
-	return &Route{
-		postMap: make(map[string]Handler),
-		getMap:  make(map[string]Handler),
+	r := &Route{
+		trees: make(map[string]*node),
+	}
+	r.RouterGroup = &RouterGroup{
+		basePath: "/",
+		route:    r,
 	}
+	return r
+}
+
+// RouterGroup 路由分组，组内的路由共享路径前缀和中间件
+type RouterGroup struct {
+	basePath string
+	handlers []Handler // 分组的中间件
+	route    *Route
+}
+
+// Group 创建子分组，子分组继承当前分组的路径前缀和中间件
+func (g *RouterGroup) Group(relativePath string, middleware ...Handler) *RouterGroup {
+	return &RouterGroup{
+		basePath: joinPaths(g.basePath, relativePath),
+		handlers: g.combineHandlers(middleware...),
+		route:    g.route,
+	}
+}
+
+// Use 添加分组的中间件，作用于之后在该分组（及其子分组）注册的路由
+//
+// 在 Route 上调用时，中间件同样作用于404、405和自动处理的OPTIONS请求。
+func (g *RouterGroup) Use(middleware ...Handler) {
+	g.handlers = append(g.handlers, middleware...)
+}
+
+// BasePath 分组的路径前缀
+func (g *RouterGroup) BasePath() string {
+	return g.basePath
+}
+
+func (g *RouterGroup) POST(path string, handler Handler) {
+	g.Handle(http.MethodPost, path, handler)
+}
+
+func (g *RouterGroup) GET(path string, handler Handler) {
+	g.Handle(http.MethodGet, path, handler)
+}
+
+func (g *RouterGroup) PUT(path string, handler Handler) {
+	g.Handle(http.MethodPut, path, handler)
 }
 
-func (r *Route) POST(path string, handler Handler) {
-	r.postLock.Lock()
-	defer r.postLock.Unlock()
-	r.postMap[path] = handler
+func (g *RouterGroup) DELETE(path string, handler Handler) {
+	g.Handle(http.MethodDelete, path, handler)
 }
 
-func (r *Route) GET(path string, handler Handler) {
-	r.getLock.Lock()
-	defer r.getLock.Unlock()
-	r.getMap[path] = handler
+func (g *RouterGroup) PATCH(path string, handler Handler) {
+	g.Handle(http.MethodPatch, path, handler)
+}
+
+// OPTIONS 注册OPTIONS路由，未注册时会自动返回该路径允许的请求方法
+func (g *RouterGroup) OPTIONS(path string, handler Handler) {
+	g.Handle(http.MethodOptions, path, handler)
+}
+
+// HEAD 注册HEAD路由，未注册时会使用GET路由处理并去掉响应体
+func (g *RouterGroup) HEAD(path string, handler Handler) {
+	g.Handle(http.MethodHead, path, handler)
+}
+
+// Any 为所有标准的请求方法注册路由
+func (g *RouterGroup) Any(path string, handler Handler) {
+	for _, method := range anyMethods {
+		g.Handle(method, path, handler)
+	}
+}
+
+// Handle 注册指定请求方法的路由
+//
+// path 支持命名参数（/messages/:channelId/:seq）和通配参数（/static/*filepath），
+// 通过 HttpContext.Param 获取参数值。同一请求方法重复注册相同路径会 panic。
+func (g *RouterGroup) Handle(method, relativePath string, handler Handler) {
+	g.route.addRoute(strings.ToUpper(method), joinPaths(g.basePath, relativePath), g.combineHandlers(handler))
+}
+
+func (g *RouterGroup) combineHandlers(handlers ...Handler) []Handler {
+	merged := make([]Handler, 0, len(g.handlers)+len(handlers))
+	merged = append(merged, g.handlers...)
+	return append(merged, handlers...)
+}
+
+func (r *Route) addRoute(method, path string, handlers []Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	root := r.trees[method]
+	if root == nil {
+		root = newNode()
+		r.trees[method] = root
+	}
+	root.addRoute(path, handlers)
+}
+
+// NoRoute 设置路由不存在时的处理函数（默认返回404）
+func (r *Route) NoRoute(handlers ...Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.noRoute = handlers
+}
+
+// NoMethod 设置路由存在但请求方法不匹配时的处理函数（默认返回405）
+func (r *Route) NoMethod(handlers ...Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.noMethod = handlers
+}
+
+func (r *Route) getValue(method, path string) (*node, Params) {
+	r.lock.RLock()
+	root := r.trees[method]
+	r.lock.RUnlock()
+	if root == nil {
+		return nil, nil
+	}
+	return root.getValue(path)
+}
+
+// allowed 路径注册了路由的请求方法
+func (r *Route) allowed(path string) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var methods []string
+	for m, root := range r.trees {
+		if n, _ := root.getValue(path); n != nil {
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// allowHeader 生成Allow响应头，包含自动处理的HEAD和OPTIONS
+func allowHeader(methods []string) string {
+	allow := append([]string{}, methods...)
+	if contains(allow, http.MethodGet) && !contains(allow, http.MethodHead) {
+		allow = append(allow, http.MethodHead)
+	}
+	if !contains(allow, http.MethodOptions) {
+		allow = append(allow, http.MethodOptions)
+	}
+	sort.Strings(allow)
+	return strings.Join(allow, ", ")
 }
 
 func (r *Route) handle(c *HttpContext) {
 	method := strings.ToUpper(c.Request.Method)
 	path := c.Request.Path
-	switch method {
-	case "POST":
-		r.postLock.RLock()
-		handler := r.postMap[path]
-		r.postLock.RUnlock()
-		if handler != nil {
-			handler(c)
-		} else {
-			c.Response.Status = http.StatusNotFound
-			c.Response.Body = []byte("404 page not found")
+
+	if n, params := r.getValue(method, path); n != nil {
+		r.serve(c, n, params)
+		return
+	}
+
+	// HEAD请求使用GET路由处理，不返回响应体
+	if method == http.MethodHead {
+		if n, params := r.getValue(http.MethodGet, path); n != nil {
+			r.serve(c, n, params)
+			c.Response.Body = nil
+			return
 		}
-	case "GET":
-		r.getLock.RLock()
-		handler := r.getMap[path]
-		r.getLock.RUnlock()
-		if handler != nil {
-			handler(c)
-		} else {
-			c.Response.Status = http.StatusNotFound
-			c.Response.Body = []byte("404 page not found")
+	}
+
+	r.lock.RLock()
+	noRoute, noMethod := r.noRoute, r.noMethod
+	r.lock.RUnlock()
+
+	allow := r.allowed(path)
+	if len(allow) == 0 {
+		c.run(r.combineHandlers(append([]Handler{notFound}, noRoute...)...))
+		return
+	}
+
+	c.Response.Headers["Allow"] = allowHeader(allow)
+	if method == http.MethodOptions {
+		c.run(r.combineHandlers(noContent))
+		return
+	}
+	c.run(r.combineHandlers(append([]Handler{methodNotAllowed}, noMethod...)...))
+}
+
+func notFound(c *HttpContext) {
+	c.Response.Status = http.StatusNotFound
+	c.Response.Body = []byte("404 page not found")
+}
+
+func methodNotAllowed(c *HttpContext) {
+	c.Response.Status = http.StatusMethodNotAllowed
+	c.Response.Body = []byte("405 method not allowed")
+}
+
+func noContent(c *HttpContext) {
+	c.Response.Status = http.StatusNoContent
+}
+
+func (r *Route) serve(c *HttpContext, n *node, params Params) {
+	c.params = params
+	c.fullPath = n.fullPath
+	c.run(n.handlers)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
 	}
+	return false
+}
 
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
 }
 
 type Handler func(*HttpContext)
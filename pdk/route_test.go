@@ -0,0 +1,136 @@
+package pdk
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func newTestRoute() *Route {
+	r := newRoute()
+	// 记录经过了 Route 上的中间件
+	r.Use(func(c *HttpContext) {
+		c.Response.Headers["X-Middleware"] = "1"
+		c.Next()
+	})
+	r.GET("/users/:id", func(c *HttpContext) {
+		c.String(http.StatusOK, "user %s", c.Param("id"))
+	})
+	r.POST("/users", func(c *HttpContext) {
+		c.String(http.StatusCreated, "created")
+	})
+	r.PUT("/users/:id", func(c *HttpContext) {
+		c.String(http.StatusOK, "updated %s", c.Param("id"))
+	})
+	r.HEAD("/ping", func(c *HttpContext) {
+		c.Response.Status = http.StatusOK
+		c.Response.Headers["X-Head"] = "1"
+	})
+	r.GET("/ping", func(c *HttpContext) {
+		c.String(http.StatusOK, "pong")
+	})
+	r.Any("/any", func(c *HttpContext) {
+		c.String(http.StatusOK, "%s", c.Request.Method)
+	})
+	api := r.Group("/api")
+	api.GET("/files/*path", func(c *HttpContext) {
+		c.String(http.StatusOK, "%s %s", c.FullPath(), c.Param("path"))
+	})
+	return r
+}
+
+func TestRouteHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int32
+		body    string
+		headers map[string]string
+	}{
+		{name: "param", method: http.MethodGet, path: "/users/42", status: http.StatusOK, body: "user 42"},
+		{name: "lower case method", method: "put", path: "/users/42", status: http.StatusOK, body: "updated 42"},
+		{name: "catch-all in group", method: http.MethodGet, path: "/api/files/a/b.txt", status: http.StatusOK, body: "/api/files/*path /a/b.txt"},
+		{name: "not found", method: http.MethodGet, path: "/missing", status: http.StatusNotFound, body: "404 page not found", headers: map[string]string{"X-Middleware": "1"}},
+		{
+			name: "method not allowed", method: http.MethodDelete, path: "/users/42",
+			status: http.StatusMethodNotAllowed, body: "405 method not allowed",
+			headers: map[string]string{"Allow": "GET, HEAD, OPTIONS, PUT", "X-Middleware": "1"},
+		},
+		{
+			name: "method not allowed without get", method: http.MethodGet, path: "/users",
+			status: http.StatusMethodNotAllowed, body: "405 method not allowed",
+			headers: map[string]string{"Allow": "OPTIONS, POST"},
+		},
+		{name: "automatic head", method: http.MethodHead, path: "/users/42", status: http.StatusOK, body: ""},
+		{name: "explicit head", method: http.MethodHead, path: "/ping", status: http.StatusOK, headers: map[string]string{"X-Head": "1"}},
+		{
+			name: "automatic options", method: http.MethodOptions, path: "/users/42",
+			status: http.StatusNoContent, headers: map[string]string{"Allow": "GET, HEAD, OPTIONS, PUT", "X-Middleware": "1"},
+		},
+		{name: "any", method: http.MethodPatch, path: "/any", status: http.StatusOK, body: "PATCH"},
+		{name: "any options", method: http.MethodOptions, path: "/any", status: http.StatusOK, body: "OPTIONS"},
+	}
+	r := newTestRoute()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewHttpContext(nil, &pluginproto.HttpRequest{Method: tt.method, Path: tt.path})
+			r.handle(c)
+			if c.Response.Status != tt.status {
+				t.Fatalf("status: got %d, want %d", c.Response.Status, tt.status)
+			}
+			if string(c.Response.Body) != tt.body {
+				t.Fatalf("body: got %q, want %q", c.Response.Body, tt.body)
+			}
+			for k, v := range tt.headers {
+				if got := c.Response.Headers[k]; got != v {
+					t.Fatalf("header %s: got %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteNoRouteNoMethod(t *testing.T) {
+	r := newRoute()
+	r.GET("/users", func(c *HttpContext) {})
+	r.NoRoute(func(c *HttpContext) {
+		c.String(http.StatusNotFound, "custom 404")
+	})
+	r.NoMethod(func(c *HttpContext) {
+		c.String(http.StatusMethodNotAllowed, "custom 405")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodGet, path: "/missing", body: "custom 404"},
+		{method: http.MethodPost, path: "/users", body: "custom 405"},
+	}
+	for _, tt := range tests {
+		c := NewHttpContext(nil, &pluginproto.HttpRequest{Method: tt.method, Path: tt.path})
+		r.handle(c)
+		if string(c.Response.Body) != tt.body {
+			t.Fatalf("%s %s: got %q, want %q", tt.method, tt.path, c.Response.Body, tt.body)
+		}
+	}
+}
+
+func TestJoinPaths(t *testing.T) {
+	tests := []struct {
+		base, relative, want string
+	}{
+		{base: "/", relative: "", want: "/"},
+		{base: "/", relative: "/api", want: "/api"},
+		{base: "/api", relative: "v1", want: "/api/v1"},
+		{base: "/api", relative: "/v1/", want: "/api/v1/"},
+	}
+	for _, tt := range tests {
+		if got := joinPaths(tt.base, tt.relative); got != tt.want {
+			t.Errorf("joinPaths(%q, %q): got %q, want %q", tt.base, tt.relative, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package pdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// jsonSchemaDraft 生成的JSON Schema版本
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern time.ParseDuration 支持的字符串，例如 "1h30m"、"1.5s"
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+// ConfigSchema 将配置结构体（包括 label、desc、default、required、options、min、max 等标签）渲染为JSON Schema
+//
+// 与插件启动时上报的配置模版使用同样的规则，config 可以是结构体或结构体指针。
+func ConfigSchema(config interface{}) ([]byte, error) {
+	t := reflect.TypeOf(config)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a struct, got %v", t)
+	}
+	schema := configTemplateSchema(getPluginConfigTemplate(t))
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// configTemplateSchema 将配置模版转换为JSON Schema
+func configTemplateSchema(template *pluginproto.ConfigTemplate) map[string]interface{} {
+	schema := objectSchema(template.Fields)
+	schema["$schema"] = jsonSchemaDraft
+	return schema
+}
+
+func objectSchema(fields []*pluginproto.Field) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, f := range fields {
+		properties[f.Name] = fieldSchema(f)
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false, // 未知的字段会被拒绝
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func fieldSchema(f *pluginproto.Field) map[string]interface{} {
+	var schema map[string]interface{}
+	switch f.Type {
+	case FieldTypeObject:
+		schema = objectSchema(f.Fields)
+	case FieldTypeArray:
+		schema = map[string]interface{}{"type": "array"}
+		if f.Elem != nil {
+			schema["items"] = fieldSchema(f.Elem)
+		}
+	case FieldTypeMap:
+		schema = map[string]interface{}{"type": "object"}
+		if f.Elem != nil {
+			schema["additionalProperties"] = fieldSchema(f.Elem)
+		}
+	case FieldTypeNumber:
+		switch f.Format {
+		case FieldFormatInteger:
+			schema = map[string]interface{}{"type": "integer"}
+		case FieldFormatDuration:
+			// pattern 只约束字符串
+			schema = map[string]interface{}{"type": []string{"integer", "string"}, "pattern": durationPattern}
+		default:
+			schema = map[string]interface{}{"type": "number"}
+		}
+	case FieldTypeBool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case FieldTypeSecret:
+		schema = map[string]interface{}{"type": "string", "format": "password", "writeOnly": true}
+	default:
+		schema = map[string]interface{}{"type": "string"}
+	}
+
+	if f.Label != "" && f.Label != f.Name {
+		schema["title"] = f.Label
+	}
+	if f.Desc != "" {
+		schema["description"] = f.Desc
+	}
+	if f.DefaultValue != "" {
+		if def, ok := schemaValue(f, f.DefaultValue); ok {
+			schema["default"] = def
+		}
+	}
+	if len(f.Options) > 0 {
+		enum := make([]interface{}, 0, len(f.Options))
+		target := f
+		if f.Type == FieldTypeArray && f.Elem != nil {
+			target = f.Elem
+		}
+		for _, o := range f.Options {
+			if v, ok := schemaValue(target, o); ok {
+				enum = append(enum, v)
+			}
+		}
+		if target == f {
+			schema["enum"] = enum
+		} else if items, ok := schema["items"].(map[string]interface{}); ok {
+			items["enum"] = enum
+		}
+	}
+
+	// min、max 对数字是取值范围，对字符串、数组、map是长度范围
+	minKey, maxKey := "minimum", "maximum"
+	switch f.Type {
+	case FieldTypeString, FieldTypeSecret:
+		minKey, maxKey = "minLength", "maxLength"
+	case FieldTypeArray:
+		minKey, maxKey = "minItems", "maxItems"
+	case FieldTypeMap:
+		minKey, maxKey = "minProperties", "maxProperties"
+	case FieldTypeObject, FieldTypeBool:
+		minKey, maxKey = "", ""
+	}
+	if f.Min != nil && minKey != "" {
+		schema[minKey] = *f.Min
+	}
+	if f.Max != nil && maxKey != "" {
+		schema[maxKey] = *f.Max
+	}
+	return schema
+}
+
+// schemaValue 将标签中的字符串（默认值、可选值）转换为字段类型对应的json值，规则与 default 标签一致，无法转换时不输出
+func schemaValue(f *pluginproto.Field, s string) (interface{}, bool) {
+	switch f.Type {
+	case FieldTypeNumber:
+		s = strings.TrimSpace(s)
+		if f.Format == FieldFormatInteger || f.Format == FieldFormatDuration {
+			if n, err := strconv.ParseInt(integerString(s), 10, 64); err == nil {
+				return n, true
+			}
+			if n, err := strconv.ParseUint(integerString(s), 10, 64); err == nil {
+				return n, true
+			}
+			if _, err := time.ParseDuration(s); err == nil && f.Format == FieldFormatDuration {
+				return s, true
+			}
+			return nil, false
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		return n, err == nil
+	case FieldTypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		return b, err == nil
+	case FieldTypeObject, FieldTypeMap:
+		var v interface{}
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err == nil
+	case FieldTypeArray:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			var v interface{}
+			err := json.Unmarshal([]byte(s), &v)
+			return v, err == nil
+		}
+		items := []interface{}{}
+		for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' }) {
+			if f.Elem == nil {
+				return nil, false
+			}
+			v, ok := schemaValue(f.Elem, strings.TrimSpace(item))
+			if !ok {
+				return nil, false
+			}
+			items = append(items, v)
+		}
+		return items, true
+	}
+	return s, true
+}
@@ -0,0 +1,95 @@
+package pdk
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaTestConfig struct {
+	Count   int           `json:"count" default:"3"`
+	Ratio   float64       `json:"ratio"`
+	Enabled bool          `json:"enabled"`
+	Timeout time.Duration `json:"timeout" default:"3s"`
+	Ports   []uint16      `json:"ports" default:"80,443"`
+}
+
+func TestConfigSchemaTypes(t *testing.T) {
+	data, err := ConfigSchema(schemaTestConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field string
+		key   string
+		want  interface{}
+	}{
+		{field: "count", key: "type", want: "integer"},
+		{field: "count", key: "default", want: float64(3)},
+		{field: "ratio", key: "type", want: "number"},
+		{field: "enabled", key: "type", want: "boolean"},
+		{field: "timeout", key: "type", want: []interface{}{"integer", "string"}},
+		{field: "timeout", key: "default", want: "3s"},
+		{field: "ports", key: "items", want: map[string]interface{}{"type": "integer"}},
+		{field: "ports", key: "default", want: []interface{}{float64(80), float64(443)}},
+	}
+	for _, tt := range tests {
+		if got := schema.Properties[tt.field][tt.key]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s.%s: got %#v, want %#v", tt.field, tt.key, got, tt.want)
+		}
+	}
+}
+
+// 解码与 ConfigSchema 的规则一致：数字和布尔值不接受字符串，整数接受小数部分为0的数字
+func TestFillConfigTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		ok   bool
+	}{
+		{name: "integer", cfg: `{"count":5}`, ok: true},
+		{name: "integral number", cfg: `{"count":5.0}`, ok: true},
+		{name: "exponent", cfg: `{"count":1e3}`, ok: true},
+		{name: "fraction", cfg: `{"count":1.5}`, ok: false},
+		{name: "numeric string", cfg: `{"count":"5"}`, ok: false},
+		{name: "bool string", cfg: `{"enabled":"true"}`, ok: false},
+		{name: "number", cfg: `{"ratio":0.5}`, ok: true},
+		{name: "duration string", cfg: `{"timeout":"1m"}`, ok: true},
+		{name: "duration number", cfg: `{"timeout":1000}`, ok: true},
+		{name: "invalid duration", cfg: `{"timeout":"1x"}`, ok: false},
+		{name: "overflow", cfg: `{"ports":[70000]}`, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := decodeConfig([]byte(tt.cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fillConfig(cfg, &schemaTestConfig{}, true)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ok: %v, err: %v", tt.ok, err)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnvTypes(t *testing.T) {
+	environ := []string{"PDK_CONFIG_COUNT=7", "PDK_CONFIG_ENABLED=true", "PDK_CONFIG_PORTS=8080,8443"}
+	cfg := configFromEnv(environ, getFields(reflect.TypeOf(schemaTestConfig{})))
+
+	var config schemaTestConfig
+	if _, err := fillConfig(cfg, &config, true); err != nil {
+		t.Fatal(err)
+	}
+	want := schemaTestConfig{Count: 7, Enabled: true, Timeout: 3 * time.Second, Ports: []uint16{8080, 8443}}
+	if !reflect.DeepEqual(config, want) {
+		t.Fatalf("got %+v, want %+v", config, want)
+	}
+}
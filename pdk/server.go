@@ -1,11 +1,14 @@
 package pdk
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"path"
+	"sync"
 	"syscall"
 
 	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
@@ -14,65 +17,152 @@ import (
 )
 
 var (
-	socketPath = flag.String("socket", "", "unix socket path") // socket路径
-	sandbox    = flag.String("sandbox", "", "sandbox dir")     // 沙箱目录
+	socketPath   = flag.String("socket", "", "unix socket path")                              // socket路径
+	sandbox      = flag.String("sandbox", "", "sandbox dir")                                  // 沙箱目录
+	configSchema = flag.Bool("config-schema", false, "print the config JSON Schema and exit") // 打印配置的JSON Schema
 )
 
 func parseCli() {
-	flag.Parse()
+	// 插件自己定义了命令行参数时可能已经解析过
+	if !flag.Parsed() {
+		flag.Parse()
+	}
 }
 
+// S 通过 RunServer 或 Plugin.Run 运行的服务，pdk.Run 不会设置
 var S *Server
 
+// RunServer 运行插件，constructor 返回的插件实例通过实现 Send、Receive、Route 等方法注册钩子
+//
+// 插件实例的 Config 字段的写入规则见 NewFromInstance。
+// RunServer 会解析命令行参数（-socket、-sandbox、-config-schema），并在收到SIGTERM或SIGINT信号时停止。
+// 新的插件建议使用 New 显式注册钩子，方法名或方法签名写错时不会被静默忽略。
 func RunServer(constructor func() interface{}, no string, opt ...Option) error {
 	if constructor == nil {
 		return fmt.Errorf("constructor is nil")
 	}
+	return runServer(NewFromInstance(constructor(), no), opt...)
+}
 
+// runServer 解析命令行参数，运行插件直到收到退出信号，并设置全局的 S
+func runServer(def *Plugin, opt ...Option) error {
 	parseCli()
 
+	// 只打印配置的JSON Schema
+	if configSchema != nil && *configSchema {
+		opts := newOptions()
+		for _, o := range opt {
+			o(opts)
+		}
+		if err := checkModules(def, opts.modules); err != nil {
+			return err
+		}
+		return printConfigSchema(def, opts.modules)
+	}
+
+	// 命令行参数优先
+	if sandbox != nil && *sandbox != "" {
+		opt = append(opt, WithSandbox(*sandbox))
+	}
+	if socketPath != nil && *socketPath != "" {
+		opt = append(opt, WithSocketPath(*socketPath))
+	}
+
+	// 收到SIGTERM信号（例如，kill命令发送的信号）或SIGINT（Ctrl+C）信号时停止
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	s, err := newPluginServer(def, opt...)
+	if err != nil {
+		return err
+	}
+	// 设置全局对象
+	S = s
+	return s.run(ctx)
+}
+
+// Run 运行插件，直到 ctx 被取消或服务端请求停止，停止时会等待正在处理的请求完成
+//
+// 与 RunServer 不同，Run 不解析命令行参数、不监听系统信号，也不设置全局的 S，
+// 同一个进程中可以运行多个相互独立的插件（例如在测试中）。
+// socket路径和沙箱目录通过 WithSocketPath、WithSandbox 或环境变量 PDK_SOCKET、PDK_SANDBOX 设置。
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	err := pdk.Run(ctx, pdk.New("wk.plugin.ai").OnReceive(onReceive))
+//
+// 在处理函数中通过 pdk.ConfigFrom[T](c.Host()) 获取配置。
+func Run(ctx context.Context, p *Plugin, opt ...Option) error {
+	if p == nil {
+		return fmt.Errorf("plugin is nil")
+	}
+	s, err := newPluginServer(p, opt...)
+	if err != nil {
+		return err
+	}
+	return s.run(ctx)
+}
+
+// newPluginServer 创建插件和服务，rpc客户端在 run 时才连接服务端
+func newPluginServer(def *Plugin, opt ...Option) (*Server, error) {
 	// 创建选项
 	opts := newOptions()
 	for _, o := range opt {
 		o(opts)
 	}
-	opts.No = no
-	if sandbox != nil && *sandbox != "" {
-		opts.Sandbox = *sandbox
+	opts.No = def.no
+	if err := checkModules(def, opts.modules); err != nil {
+		return nil, err
 	}
+
 	// 创建rpc客户端
-	rpcClient := newRpcClient(no)
-	err := rpcClient.Start()
+	rpcClient, err := newRpcClient(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 创建插件
-	plugin := newPlugin(opts, constructor, rpcClient)
+	plugin := newPlugin(opts, def, rpcClient)
 
 	// 创建服务
 	s := newServer(rpcClient, plugin, opts)
-	// 设置全局对象
-	S = s
-	// 运行服务
-	err = s.run()
+	if len(opts.onReady) > 0 {
+		plugin.readyHandler = func() {
+			for _, onReady := range opts.onReady {
+				onReady(s)
+			}
+		}
+	}
+	// 注入服务端接口
+	plugin.setHost(s)
+	// 加载本地配置，未连接WuKongIM时也能使用
+	if opts.LocalConfig {
+		plugin.loadInitialConfig()
+	}
+	return s, nil
+}
+
+// printConfigSchema 打印插件（包括各模块）配置的JSON Schema
+func printConfigSchema(def *Plugin, modules []*Module) error {
+	template := configTemplate(def, modules)
+	if len(template.Fields) == 0 {
+		return fmt.Errorf("plugin has no config")
+	}
+	data, err := json.MarshalIndent(configTemplateSchema(template), "", "  ")
 	if err != nil {
 		return err
 	}
-	// 停止
-	rpcClient.Stop()
-	s.stop()
-
+	fmt.Println(string(data))
 	return nil
 }
 
-func newRpcClient(pluginNo string) *client.Client {
-	socketPath, err := getSocketPath()
+func newRpcClient(opts *Options) (*client.Client, error) {
+	socketPath, err := getSocketPath(opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return client.New(fmt.Sprintf("unix://%s", socketPath), client.WithUid(pluginNo))
+	return client.New(fmt.Sprintf("unix://%s", socketPath), client.WithUid(opts.No)), nil
 }
 
 type Server struct {
@@ -80,18 +170,53 @@ type Server struct {
 	plugin    *plugin
 	opts      *Options
 	wklog.Log
-	sigChan chan os.Signal
+	stopC chan struct{} // 服务端请求停止插件
+
+	ctx    context.Context // 根上下文，请求的上下文都派生自它，停止时取消
+	cancel context.CancelFunc
+
+	workMu   sync.RWMutex
+	draining bool           // 正在停止，不再处理新的请求
+	inflight sync.WaitGroup // 正在处理的请求
+
+	streams *streamRegistry // 插件打开的流
 }
 
 func newServer(rpcClient *client.Client, plugin *plugin, opts *Options) *Server {
-
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		opts:      opts,
 		rpcClient: rpcClient,
 		plugin:    plugin,
-		Log:       wklog.NewWKLog(fmt.Sprintf("Server[%s]", opts.No)),
-		sigChan:   make(chan os.Signal, 1),
+		Log:       newLogger(opts, fmt.Sprintf("Server[%s]", opts.No)),
+		stopC:     make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		streams:   newStreamRegistry(),
+	}
+}
+
+// newLogger 通过 WithLogger 设置了日志时使用设置的日志，否则使用带 prefix 前缀的 wklog 全局日志
+func newLogger(opts *Options, prefix string) wklog.Log {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return wklog.NewWKLog(prefix)
+}
+
+// hostLog 服务的日志，host 不是 *Server 时（例如测试中的假实现）使用带 prefix 前缀的 wklog 全局日志
+func hostLog(host HostAPI, prefix string) wklog.Log {
+	if s, ok := host.(*Server); ok && s != nil {
+		return s.Log
 	}
+	return wklog.NewWKLog(prefix)
+}
+
+// Context 服务的根上下文，插件开始停止时取消
+//
+// 插件在钩子之外启动的后台任务（例如定时任务）可以监听它来结束。
+func (s *Server) Context() context.Context {
+	return s.ctx
 }
 
 // Request 向服务端发送请求
@@ -198,9 +323,13 @@ func (s *Server) RequestStreamOpen(streamInfo *pluginproto.Stream) (*pluginproto
 
 // RequestStreamClose 请求关闭流
 func (s *Server) RequestStreamClose(streamNo string) error {
-	req := &pluginproto.StreamCloseReq{
+	return s.RequestStreamCloseReq(&pluginproto.StreamCloseReq{
 		StreamNo: streamNo,
-	}
+	})
+}
+
+// RequestStreamCloseReq 请求关闭流，可以携带关闭原因等完整的请求参数
+func (s *Server) RequestStreamCloseReq(req *pluginproto.StreamCloseReq) error {
 	data, err := req.Marshal()
 	if err != nil {
 		return err
@@ -214,15 +343,26 @@ func (s *Server) RequestStreamClose(streamNo string) error {
 
 // RequestStreamWrite 请求写入流
 func (s *Server) RequestStreamWrite(req *pluginproto.StreamWriteReq) error {
+	_, err := s.RequestStreamWriteResp(req)
+	return err
+}
+
+// RequestStreamWriteResp 请求写入流，返回写入的消息ID和客户端消息编号
+func (s *Server) RequestStreamWriteResp(req *pluginproto.StreamWriteReq) (*pluginproto.StreamWriteResp, error) {
 	data, err := req.Marshal()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = s.Request("/stream/write", data)
+	respData, err := s.Request("/stream/write", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	resp := &pluginproto.StreamWriteResp{}
+	err = resp.Unmarshal(respData)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 // RequestSend 请求发送消息
@@ -250,23 +390,37 @@ func (s *Server) NodeId() uint64 {
 	return s.plugin.serverNodeId
 }
 
+// RecoveredPanics 插件钩子中已恢复的panic数量
+func (s *Server) RecoveredPanics() uint64 {
+	return s.plugin.recoveredPanics.Load()
+}
+
 // SandboxDir 插件沙箱目录 （插件数据可以保存到此目录下）
 func (s *Server) SandboxDir() string {
 	return s.plugin.sandbox
 }
 
-func (s *Server) run() error {
+// run 连接服务端并处理请求，直到 ctx 被取消或服务端请求停止，然后优雅地停止
+func (s *Server) run(ctx context.Context) error {
 
+	// 在连接服务端之前注册路由和连接回调，连接成功后立即可以处理请求
 	s.routes()
 	s.onMessage()
-
 	s.plugin.start()
 
-	// 通知该channel接收SIGTERM信号（例如，kill命令发送的信号）和SIGINT（Ctrl+C）信号
-	signal.Notify(s.sigChan, syscall.SIGTERM, syscall.SIGINT)
-	// 阻塞直到接收到信号
-	<-s.sigChan
+	err := s.rpcClient.Start()
+	if err != nil {
+		s.cancel()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-s.stopC:
+	}
 
+	// 停止：等待正在处理的请求完成后再停止插件和关闭rpc客户端
+	s.shutdown()
 	return nil
 }
 
@@ -274,10 +428,10 @@ func (s *Server) stop() {
 	s.plugin.stop()
 }
 
-func getSocketPath() (string, error) {
+func getSocketPath(opts *Options) (string, error) {
 
-	if socketPath != nil && *socketPath != "" {
-		return *socketPath, nil
+	if opts.SocketPath != "" {
+		return opts.SocketPath, nil
 	}
 
 	homeDir, err := os.UserHomeDir()
@@ -0,0 +1,127 @@
+package pdk_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+type greetingConfig struct {
+	Greeting string `json:"greeting" default:"hello"`
+}
+
+func TestWithOnReady(t *testing.T) {
+	host := newRunningHost(t)
+	var (
+		mu      sync.Mutex
+		calls   []string
+		servers []*pdk.Server
+	)
+	onReady := func(name string) func(s *pdk.Server) {
+		return func(s *pdk.Server) {
+			mu.Lock()
+			defer mu.Unlock()
+			// 调用时已经应用了配置
+			calls = append(calls, name+":"+pdk.ConfigFrom[greetingConfig](s).Greeting)
+			servers = append(servers, s)
+		}
+	}
+	p := pdk.New("wk.plugin.ready").
+		OnSetup(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "setup")
+		}).
+		WithConfig(pdk.TypedConfig[greetingConfig](nil))
+	if err := host.Run(p, pdk.WithOnReady(onReady("first")), pdk.WithOnReady(onReady("second"))); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"setup", "first:hello", "second:hello"}; !slices.Equal(calls, want) {
+		t.Fatalf("calls: got %v, want %v", calls, want)
+	}
+	for _, s := range servers {
+		if s != host.Server() {
+			t.Fatal("onReady got a different server")
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	host := newRunningHost(t)
+	logger := &errorLogger{}
+	p := pdk.New("wk.plugin.logger").OnSend(func(c *pdk.Context) {
+		panic("boom")
+	})
+	if err := host.Run(p, pdk.WithLogger(logger)); err != nil {
+		t.Fatal(err)
+	}
+	if host.Server().Log != logger {
+		t.Fatal("server does not use the logger")
+	}
+	if _, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1}); err == nil {
+		t.Fatal("expected an error when Send panics")
+	}
+	if !slices.Contains(logger.messages(), "plugin panic recovered") {
+		t.Fatalf("logged errors: %v", logger.messages())
+	}
+}
+
+func TestRunMultipleServers(t *testing.T) {
+	greetings := []string{"hi", "hey"}
+	hosts := make([]*pdktest.Host, len(greetings))
+	for i, greeting := range greetings {
+		host, err := pdktest.NewHost(pdktest.WithConfig(map[string]interface{}{"greeting": greeting}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(host.Close)
+		hosts[i] = host
+	}
+	var wg sync.WaitGroup
+	// 同时启动和停止，插件运行的时间不超过wkrpc客户端的心跳间隔（1s），
+	// wkrpc的tick与OnTraffic读写idleTick时没有加锁，发送心跳后会被 -race 报告
+	defer func() {
+		for _, host := range hosts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				host.Close()
+			}()
+		}
+		wg.Wait()
+	}()
+	errs := make([]error, len(hosts))
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = host.Run(pdk.New("wk.plugin.multi").WithConfig(pdk.TypedConfig[greetingConfig](nil)))
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hosts[0].Server() == hosts[1].Server() {
+		t.Fatal("hosts share a server")
+	}
+	for i, host := range hosts {
+		if cfg := pdk.ConfigFrom[greetingConfig](host.Server()); cfg.Greeting != greetings[i] {
+			t.Fatalf("server %d config: %+v", i, cfg)
+		}
+	}
+	// Run 不设置全局的 S
+	if pdk.S != nil {
+		t.Fatal("Run set the global server")
+	}
+}
@@ -0,0 +1,65 @@
+package pdk
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrShuttingDown 插件正在停止，不再处理新的请求
+var ErrShuttingDown = errors.New("plugin is shutting down")
+
+// beginWork 开始处理一个请求，插件正在停止时返回false
+//
+// 返回true时处理完成后需要调用 endWork。
+func (s *Server) beginWork() bool {
+	s.workMu.RLock()
+	defer s.workMu.RUnlock()
+	if s.draining {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// endWork 请求处理完成
+func (s *Server) endWork() {
+	s.inflight.Done()
+}
+
+// drain 停止接收新的请求，取消根上下文，并等待正在处理的请求完成（最多等待 ShutdownTimeout）
+func (s *Server) drain() {
+	s.workMu.Lock()
+	s.draining = true
+	s.workMu.Unlock()
+
+	// 通知正在执行的处理函数尽快结束（例如关闭未写完的流）
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	if s.opts.ShutdownTimeout <= 0 {
+		<-done
+		return
+	}
+	timer := time.NewTimer(s.opts.ShutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		s.Warn("shutdown timeout, in-flight handlers are abandoned", zap.Duration("timeout", s.opts.ShutdownTimeout))
+	}
+}
+
+// shutdown 优雅停止：停止接收新的请求并等待正在处理的请求完成，然后调用插件的 Stop，关闭未关闭的流，最后关闭rpc客户端
+func (s *Server) shutdown() {
+	s.drain()
+	s.stop()
+	s.streams.closeAll("plugin stopped")
+	s.rpcClient.Stop()
+}
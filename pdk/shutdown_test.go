@@ -0,0 +1,108 @@
+package pdk_test
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+// blockingPlugin Receive 阻塞到 release 关闭
+type blockingPlugin struct {
+	entered   chan struct{}
+	release   chan struct{}
+	cancelled atomic.Bool // 处理函数的上下文是否被取消
+	finished  atomic.Bool
+	stopped   atomic.Bool
+	stopLate  atomic.Bool // Stop 是否在处理函数完成后才调用
+}
+
+func newBlockingPlugin() *blockingPlugin {
+	return &blockingPlugin{
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (b *blockingPlugin) plugin() *pdk.Plugin {
+	return pdk.New("wk.plugin.drain").
+		OnReceive(func(c *pdk.Context) {
+			close(b.entered)
+			<-c.Context().Done()
+			b.cancelled.Store(true)
+			<-b.release
+			b.finished.Store(true)
+		}).
+		OnSend(func(c *pdk.Context) {}).
+		OnStop(func() {
+			b.stopLate.Store(b.finished.Load())
+			b.stopped.Store(true)
+		})
+}
+
+func (b *blockingPlugin) receive(host interface {
+	Receive(*pluginproto.RecvPacket) error
+}) chan error {
+	errC := make(chan error, 1)
+	go func() {
+		errC <- host.Receive(&pluginproto.RecvPacket{FromUid: "u1", ToUid: "bot", ChannelId: "bot", ChannelType: 1})
+	}()
+	<-b.entered
+	return errC
+}
+
+func TestDrainWaitsForInflightHandlers(t *testing.T) {
+	host := newRunningHost(t)
+	b := newBlockingPlugin()
+	if err := host.Run(b.plugin()); err != nil {
+		t.Fatal(err)
+	}
+	recvErrC := b.receive(host)
+
+	if err := host.StopPlugin(); err != nil {
+		t.Fatal(err)
+	}
+	// 停止时拒绝新的请求
+	waitFor(t, func() bool {
+		_, err := host.Send(&pluginproto.SendPacket{FromUid: "u1", ChannelId: "u2", ChannelType: 1})
+		return err != nil && strings.Contains(err.Error(), pdk.ErrShuttingDown.Error())
+	})
+	waitFor(t, b.cancelled.Load)
+	time.Sleep(50 * time.Millisecond)
+	if b.stopped.Load() {
+		t.Fatal("plugin stopped before the in-flight handler finished")
+	}
+
+	close(b.release)
+	if err := <-recvErrC; err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, b.stopped.Load)
+	if !b.stopLate.Load() {
+		t.Fatal("Stop was called before the in-flight handler finished")
+	}
+}
+
+func TestDrainShutdownTimeout(t *testing.T) {
+	host := newRunningHost(t)
+	b := newBlockingPlugin()
+	defer close(b.release)
+	// 超时时间小于wkrpc客户端100ms的tick间隔，wkrpc的tick与OnTraffic读写idleTick时没有加锁，
+	// 停止过程跨过tick时会被 -race 报告
+	if err := host.Run(b.plugin(), pdk.WithShutdownTimeout(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	b.receive(host)
+
+	if err := host.StopPlugin(); err != nil {
+		t.Fatal(err)
+	}
+	// 超时后不再等待处理函数，直接停止插件
+	waitFor(t, b.stopped.Load)
+	if b.finished.Load() {
+		t.Fatal("handler should still be running")
+	}
+}
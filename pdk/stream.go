@@ -1,35 +1,328 @@
 package pdk
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+	"go.uber.org/zap"
 )
 
+// ErrStreamClosed 向已关闭的流写入
+var ErrStreamClosed = errors.New("stream is closed")
+
+// 流的默认超时，忘记关闭（例如处理函数返回或panic时没有调用 Close）的流最终也会被关闭
+const (
+	DefaultStreamIdleTimeout = 5 * time.Minute  // 大模型思考阶段可能长时间没有输出
+	DefaultStreamMaxLifetime = 30 * time.Minute // 较长的回复也能在这个时间内完成
+)
+
+// maxStreamBufferSize 只按时间间隔写入时缓冲的最大字节数，超过后 Write 会同步写入服务端
+const maxStreamBufferSize = 64 * 1024
+
+// Stream 流式消息（例如AI逐字输出的回复），实现了 io.WriteCloser 和 io.StringWriter
+//
+// 默认每次 Write 都立即写入服务端。通过 StreamWithFlushSize、StreamWithFlushInterval 开启缓冲后，
+// 写入的内容会先合并，缓冲达到指定大小、超过指定时间或调用 Flush 时才写入服务端；
+// 服务端处理较慢时，缓冲已满的 Write 会阻塞直到写入完成。
+//
+// 通过 StreamWithEncoder 设置编码方式后可以直接写入纯文本：
+//
+//	stream, _ := c.OpenStream(pdk.StreamWithEncoder(pdk.TextStreamEncoder), pdk.StreamWithFlushInterval(200*time.Millisecond))
+//	defer stream.Close()
+//	io.Copy(stream, reader)
+//
+// 插件停止时会关闭所有未关闭的流。以下情况流也会被自动关闭，之后的写入返回 ErrStreamClosed：
+//   - 超过空闲超时没有写入（默认 DefaultStreamIdleTimeout），见 StreamWithIdleTimeout 和 WithStreamIdleTimeout
+//   - 超过最长存活时间（默认 DefaultStreamMaxLifetime），见 StreamWithMaxLifetime 和 WithStreamMaxLifetime
+//   - 上下文结束（需要开启），见 StreamWithContext 和 WithStreamBindRequest
 type Stream struct {
 	streamNo   string
 	streamInfo *pluginproto.Stream
-	s          *Server
+	host       HostAPI
+	opts       *StreamOptions
+
+	flushMu sync.Mutex // 保证按顺序写入服务端，同时只有一个写入请求
+
+	mu     sync.Mutex
+	buf    []byte      // 未写入服务端的内容
+	timer  *time.Timer // 按时间间隔写入的定时器
+	err    error       // 后台写入失败的错误，在下一次 Write、Flush 或 Close 时返回
+	closed bool
+	ended  bool // 关闭请求已发送，需要持有 s.flushMu 修改
+
+	lastResp *pluginproto.StreamWriteResp // 最后一次写入的结果
+
+	openedAt    time.Time
+	lastActive  atomic.Int64  // 最后一次写入的时间（UnixNano）
+	closeReason string        // 自动关闭的原因
+	doneC       chan struct{} // 开始关闭时关闭，停止监控
+	closedC     chan struct{} // 关闭请求完成后关闭
+	onClose     func(*Stream) // 关闭后的回调（从插件的活跃流中移除）
 }
 
-func newStream(streamNo string, streamInfo *pluginproto.Stream, s *Server) *Stream {
-	return &Stream{
+func newStream(streamNo string, streamInfo *pluginproto.Stream, host HostAPI, opts *StreamOptions) *Stream {
+	if opts == nil {
+		opts = newStreamOptions()
+	}
+	s := &Stream{
 		streamNo:   streamNo,
 		streamInfo: streamInfo,
-		s:          s,
+		host:       host,
+		opts:       opts,
+		openedAt:   time.Now(),
+		doneC:      make(chan struct{}),
+		closedC:    make(chan struct{}),
+	}
+	s.lastActive.Store(s.openedAt.UnixNano())
+	return s
+}
+
+// StreamNo 流编号
+func (s *Stream) StreamNo() string {
+	return s.streamNo
+}
+
+// ClientMsgNo 流的客户端消息编号，通过 StreamWithClientMsgNo 设置
+func (s *Stream) ClientMsgNo() string {
+	return s.streamInfo.ClientMsgNo
+}
+
+// MessageId 最后一次写入服务端后返回的消息ID，还未写入时为0
+func (s *Stream) MessageId() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastResp.GetMessageId()
+}
+
+// Write 写入流，开启缓冲时只有缓冲满了才会写入服务端
+//
+// 需要服务端返回的消息ID时使用 WriteMessage。
+func (s *Stream) Write(data []byte) (int, error) {
+	s.touch()
+	if !s.buffered() {
+		if _, err := s.WriteMessage(data); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	s.mu.Lock()
+	if err := s.checkWritable(); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	s.buf = append(s.buf, data...)
+	full := len(s.buf) >= s.flushSize()
+	if !full && s.timer == nil && s.opts.FlushInterval > 0 {
+		s.timer = time.AfterFunc(s.opts.FlushInterval, s.flushInBackground)
 	}
+	s.mu.Unlock()
+
+	// 缓冲已满时同步写入，服务端较慢时阻塞调用方
+	if full {
+		s.flushMu.Lock()
+		defer s.flushMu.Unlock()
+		if err := s.flushLocked(false); err != nil {
+			return len(data), err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString 写入字符串，见 Write
+func (s *Stream) WriteString(str string) (int, error) {
+	return s.Write([]byte(str))
+}
+
+// WriteMessage 先写入缓冲的内容，再立即将 data 写入服务端，返回服务端的写入结果（消息ID和客户端消息编号）
+func (s *Stream) WriteMessage(data []byte) (*pluginproto.StreamWriteResp, error) {
+	s.touch()
+	s.mu.Lock()
+	err := s.checkWritable()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	// 等待写入期间流可能已被关闭（例如自动关闭），关闭请求之后不能再写入
+	s.mu.Lock()
+	err = s.checkWritable()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.flushLocked(true); err != nil {
+		return nil, err
+	}
+	return s.writeChunk(data)
+}
+
+// Flush 将缓冲的内容写入服务端
+func (s *Stream) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	return s.flushLocked(true)
 }
 
+// Close 写入缓冲的内容并关闭流，可以多次调用，流正在被关闭时等待关闭完成
 func (s *Stream) Close() error {
+	return s.close(nil)
+}
+
+// CloseWithPayload 写入缓冲的内容并关闭流，data 为流结束时的最终消息（例如完整的回复）
+//
+// 设置了 StreamWithEncoder 时 data 会先编码，与 Write 写入的内容一致。
+func (s *Stream) CloseWithPayload(data []byte) error {
+	if s.opts.Encoder != nil {
+		payload, err := s.opts.Encoder(data)
+		if err != nil {
+			return err
+		}
+		data = payload
+	}
+	return s.close(data)
+}
+
+func (s *Stream) close(payload []byte) error {
 
 	if strings.TrimSpace(s.streamNo) == "" {
 		return errors.New("streamNo is empty")
 	}
-	return s.s.RequestStreamClose(s.streamNo)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.closedC
+		return nil
+	}
+	s.closed = true
+	s.stopTimer()
+	close(s.doneC)
+	s.mu.Unlock()
+	defer func() {
+		close(s.closedC)
+		if s.onClose != nil {
+			s.onClose(s)
+		}
+	}()
+
+	// 写入缓冲的内容和发送关闭请求期间持有 flushMu，保证关闭请求之后不会再有写入请求
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	err := s.flushLocked(true)
+
+	closeErr := s.host.RequestStreamCloseReq(&pluginproto.StreamCloseReq{
+		StreamNo:    s.streamNo,
+		ChannelId:   s.streamInfo.ChannelId,
+		ChannelType: s.streamInfo.ChannelType,
+		Payload:     payload,
+	})
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+	if closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+// flushSize 缓冲达到多少字节时同步写入服务端，只按时间写入时也限制缓冲的大小
+func (s *Stream) flushSize() int {
+	if s.opts.FlushSize > 0 {
+		return s.opts.FlushSize
+	}
+	return maxStreamBufferSize
+}
+
+func (s *Stream) buffered() bool {
+	return s.opts.FlushSize > 0 || s.opts.FlushInterval > 0
+}
+
+// checkWritable 需要持有 s.mu
+func (s *Stream) checkWritable() error {
+	if s.closed {
+		if s.closeReason != "" {
+			return fmt.Errorf("%w: %s", ErrStreamClosed, s.closeReason)
+		}
+		return ErrStreamClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return nil
+}
+
+// stopTimer 需要持有 s.mu
+func (s *Stream) stopTimer() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// flushLocked 写入缓冲的内容，需要持有 s.flushMu
+//
+// all 为false时保留末尾不完整的UTF-8字符，等待后续的内容。
+func (s *Stream) flushLocked(all bool) error {
+	s.mu.Lock()
+	if s.ended {
+		// 缓冲的内容已在关闭时写入
+		s.mu.Unlock()
+		return nil
+	}
+	if s.err != nil {
+		err := s.err
+		s.mu.Unlock()
+		return err
+	}
+	data := s.buf
+	if !all && s.opts.Encoder != nil {
+		n := completeUTF8(data)
+		data, s.buf = data[:n], append([]byte(nil), data[n:]...)
+	} else {
+		s.buf = nil
+	}
+	s.stopTimer()
+	if len(s.buf) > 0 && s.opts.FlushInterval > 0 {
+		s.timer = time.AfterFunc(s.opts.FlushInterval, s.flushInBackground)
+	}
+	s.mu.Unlock()
+
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := s.writeChunk(data)
+	if err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}
+	return err
 }
 
-func (s *Stream) Write(data []byte) error {
+// flushInBackground 定时器到期后写入缓冲的内容，错误在下一次 Write、Flush 或 Close 时返回
+func (s *Stream) flushInBackground() {
+	_ = s.Flush()
+}
+
+// writeChunk 编码后写入服务端，需要持有 s.flushMu
+func (s *Stream) writeChunk(data []byte) (*pluginproto.StreamWriteResp, error) {
+	payload := data
+	if s.opts.Encoder != nil {
+		var err error
+		payload, err = s.opts.Encoder(data)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if s.streamInfo != nil && s.streamInfo.Header != nil {
 		s.streamInfo.Header.RedDot = false // 流消息不需要红点
@@ -37,31 +330,218 @@ func (s *Stream) Write(data []byte) error {
 		s.streamInfo.Header = &pluginproto.Header{RedDot: false}
 	}
 
-	return s.s.RequestStreamWrite(&pluginproto.StreamWriteReq{
+	resp, err := s.host.RequestStreamWriteResp(&pluginproto.StreamWriteReq{
 		Header:      s.streamInfo.Header,
 		StreamNo:    s.streamNo,
+		ClientMsgNo: s.streamInfo.ClientMsgNo,
 		FromUid:     s.streamInfo.FromUid,
 		ChannelId:   s.streamInfo.ChannelId,
 		ChannelType: s.streamInfo.ChannelType,
-		Payload:     data,
+		Payload:     payload,
 	})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.lastResp = resp
+	s.mu.Unlock()
+	return resp, nil
+}
+
+// touch 记录写入时间，用于空闲超时
+func (s *Stream) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+func (s *Stream) lastActiveAt() time.Time {
+	return time.Unix(0, s.lastActive.Load())
+}
+
+// watch 在后台监控流，上下文结束、空闲超时或超过最长存活时间时自动关闭流
+func (s *Stream) watch() {
+	var ctxDone <-chan struct{}
+	if s.opts.Context != nil {
+		ctxDone = s.opts.Context.Done()
+	}
+	if ctxDone == nil && s.opts.IdleTimeout <= 0 && s.opts.MaxLifetime <= 0 {
+		return
+	}
+	go func() {
+		var lifetimeC, idleC <-chan time.Time
+		if s.opts.MaxLifetime > 0 {
+			lifetime := time.NewTimer(s.opts.MaxLifetime)
+			defer lifetime.Stop()
+			lifetimeC = lifetime.C
+		}
+		var idle *time.Timer
+		if s.opts.IdleTimeout > 0 {
+			idle = time.NewTimer(s.opts.IdleTimeout)
+			defer idle.Stop()
+			idleC = idle.C
+		}
+		for {
+			select {
+			case <-s.doneC:
+				return
+			case <-ctxDone:
+				s.autoClose(fmt.Sprintf("context done: %v", s.opts.Context.Err()))
+			case <-lifetimeC:
+				s.autoClose("max lifetime exceeded")
+			case <-idleC:
+				// 期间有写入时重新计时
+				if idleFor := time.Since(s.lastActiveAt()); idleFor < s.opts.IdleTimeout {
+					idle.Reset(s.opts.IdleTimeout - idleFor)
+					continue
+				}
+				s.autoClose("idle timeout")
+			}
+			return
+		}
+	}()
+}
+
+// autoClose 自动关闭未关闭的流
+func (s *Stream) autoClose(reason string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closeReason = reason
+	s.mu.Unlock()
+
+	log := hostLog(s.host, "Stream")
+	log.Warn("stream auto closed", zap.String("streamNo", s.streamNo), zap.String("reason", reason))
+	if err := s.close(nil); err != nil {
+		log.Error("auto close stream error", zap.String("streamNo", s.streamNo), zap.Error(err))
+	}
+}
+
+// completeUTF8 data 中完整的UTF-8字符的长度（不包括末尾被截断的字符）
+func completeUTF8(data []byte) int {
+	// UTF-8字符最长4个字节，只需要检查末尾的3个字节
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// StreamEncoder 将写入流的内容编码为消息内容，可以直接将纯文本写入（或 io.Copy）到流中
+type StreamEncoder func(chunk []byte) ([]byte, error)
+
+// TextStreamEncoder 将写入的内容编码为文本消息 {"type":1,"content":"..."}
+func TextStreamEncoder(chunk []byte) ([]byte, error) {
+	return (&PayloadText{Type: 1, Content: string(chunk)}).Encode()
 }
 
-type StreamOption func(*pluginproto.Stream)
+// StreamOptions 打开流的选项
+type StreamOptions struct {
+	Header        *pluginproto.Header
+	ClientMsgNo   string        // 客户端消息编号，流的每次写入都会带上（相同编号，客户端只会显示一条）
+	Payload       []byte        // 打开流时的消息内容
+	Encoder       StreamEncoder // 写入内容的编码方式，为nil时原样写入
+	FlushSize     int           // 缓冲的字节数达到 FlushSize 时写入服务端，0表示不按大小写入
+	FlushInterval time.Duration // 缓冲的内容最多等待多久写入服务端，0表示不按时间写入
+
+	Context     context.Context // 上下文结束时自动关闭流，为nil时不监控
+	IdleTimeout time.Duration   // 超过多久没有写入时自动关闭流，默认 DefaultStreamIdleTimeout，0表示不限制
+	MaxLifetime time.Duration   // 打开后最多多久自动关闭流，默认 DefaultStreamMaxLifetime，0表示不限制
+
+	infoFuncs []func(*pluginproto.Stream) // 打开流之前修改流信息，见 StreamWithInfo
+}
+
+func newStreamOptions() *StreamOptions {
+	return &StreamOptions{
+		IdleTimeout: DefaultStreamIdleTimeout,
+		MaxLifetime: DefaultStreamMaxLifetime,
+	}
+}
+
+// StreamOption 打开流的选项
+//
+// 之前的版本中 StreamOption 为 func(*pluginproto.Stream)，自定义的选项可以通过 StreamWithInfo 继续使用。
+type StreamOption func(*StreamOptions)
+
+// StreamWithInfo 在打开流之前修改发送给服务端的流信息，在其他选项之后按顺序执行
+//
+//	pdk.StreamWithInfo(func(s *pluginproto.Stream) { s.ChannelId = "robot" })
+func StreamWithInfo(fn func(*pluginproto.Stream)) StreamOption {
+	return func(o *StreamOptions) {
+		o.infoFuncs = append(o.infoFuncs, fn)
+	}
+}
 
 func StreamWithHeader(header *pluginproto.Header) StreamOption {
-	return func(s *pluginproto.Stream) {
-		s.Header = header
+	return func(o *StreamOptions) {
+		o.Header = header
+	}
+}
+
+// StreamWithClientMsgNo 设置流的客户端消息编号，客户端可以用来关联流的每次写入和最终的消息
+func StreamWithClientMsgNo(clientMsgNo string) StreamOption {
+	return func(o *StreamOptions) {
+		o.ClientMsgNo = clientMsgNo
 	}
 }
 
 func StreamWithPayload(payload Payload) StreamOption {
-	return func(s *pluginproto.Stream) {
+	return func(o *StreamOptions) {
 		data, err := payload.Encode()
 		if err != nil {
 			panic(err)
 		}
-		s.Payload = data
+		o.Payload = data
+	}
+}
+
+// StreamWithEncoder 设置写入内容的编码方式，例如 TextStreamEncoder
+//
+// 开启缓冲时多次写入的内容会合并后再编码，所以写入的需要是可以拼接的内容（例如纯文本），而不是已经编码好的消息。
+func StreamWithEncoder(encoder StreamEncoder) StreamOption {
+	return func(o *StreamOptions) {
+		o.Encoder = encoder
+	}
+}
+
+// StreamWithFlushSize 开启缓冲，缓冲的字节数达到 size 时写入服务端
+func StreamWithFlushSize(size int) StreamOption {
+	return func(o *StreamOptions) {
+		o.FlushSize = size
+	}
+}
+
+// StreamWithFlushInterval 开启缓冲，缓冲的内容最多等待 interval 后写入服务端
+func StreamWithFlushInterval(interval time.Duration) StreamOption {
+	return func(o *StreamOptions) {
+		o.FlushInterval = interval
+	}
+}
+
+// StreamWithContext 设置流的上下文，上下文结束时自动关闭流，默认不监控
+//
+// 例如 StreamWithContext(c.Context())，处理函数返回、panic或请求超时后关闭流。
+func StreamWithContext(ctx context.Context) StreamOption {
+	return func(o *StreamOptions) {
+		o.Context = ctx
+	}
+}
+
+// StreamWithIdleTimeout 设置流的空闲超时，超过 timeout 没有写入时自动关闭流，0表示不限制
+func StreamWithIdleTimeout(timeout time.Duration) StreamOption {
+	return func(o *StreamOptions) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// StreamWithMaxLifetime 设置流的最长存活时间，打开 lifetime 后自动关闭流，0表示不限制
+func StreamWithMaxLifetime(lifetime time.Duration) StreamOption {
+	return func(o *StreamOptions) {
+		o.MaxLifetime = lifetime
 	}
 }
 
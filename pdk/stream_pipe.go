@@ -0,0 +1,215 @@
+package pdk
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+)
+
+// PipeOptions 将上游的文本写入流的选项
+type PipeOptions struct {
+	FlushInterval time.Duration // 合并多久内的文本后写入流，0表示每段文本都立即写入
+	FlushSize     int           // 合并的文本达到多少字节时立即写入流，0表示不按大小写入
+	ErrorMessage  string        // 上游返回错误时写入流并追加到最终消息的内容，为空时不写入
+}
+
+func newPipeOptions() *PipeOptions {
+	return &PipeOptions{
+		FlushInterval: 100 * time.Millisecond,
+	}
+}
+
+type PipeOption func(*PipeOptions)
+
+// PipeWithFlushInterval 设置合并文本的时间间隔，0表示每段文本都立即写入
+func PipeWithFlushInterval(interval time.Duration) PipeOption {
+	return func(o *PipeOptions) {
+		o.FlushInterval = interval
+	}
+}
+
+// PipeWithFlushSize 合并的文本达到 size 字节时立即写入
+func PipeWithFlushSize(size int) PipeOption {
+	return func(o *PipeOptions) {
+		o.FlushSize = size
+	}
+}
+
+// PipeWithErrorMessage 设置上游返回错误时写入流的内容，例如 "\n\n回复出错了，请稍后再试"
+func PipeWithErrorMessage(message string) PipeOption {
+	return func(o *PipeOptions) {
+		o.ErrorMessage = message
+	}
+}
+
+type pipeChunk struct {
+	text string
+	err  error
+}
+
+// Pipe 将上游（例如大模型SDK）逐段返回的文本写入流，合并后写入以减少请求，结束后以完整的文本关闭流
+//
+// 上游返回错误时写入 PipeWithErrorMessage 设置的内容后关闭流，并返回上游的错误。
+// 流被关闭（例如请求结束或空闲超时）时立即返回，上游需要通过自己的 context 停止。
+// 流没有设置 StreamWithEncoder 时，文本按文本消息 {"type":1,"content":"..."} 编码。
+// 返回写入的完整文本（包括错误提示）。
+//
+//	text, err := stream.Pipe(func(yield func(string, error) bool) {
+//		for {
+//			resp, err := upstream.Recv()
+//			if err == io.EOF {
+//				return
+//			}
+//			if err != nil {
+//				yield("", err)
+//				return
+//			}
+//			if !yield(resp.Delta, nil) {
+//				return
+//			}
+//		}
+//	}, pdk.PipeWithErrorMessage("\n\n回复出错了，请稍后再试"))
+func (s *Stream) Pipe(seq iter.Seq2[string, error], opt ...PipeOption) (string, error) {
+	opts := newPipeOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+
+	// 在单独的goroutine中读取上游，以便按时间间隔写入和在流关闭时返回
+	chunkC := make(chan pipeChunk)
+	stopC := make(chan struct{})
+	defer close(stopC)
+	go func() {
+		defer close(chunkC)
+		send := func(chunk pipeChunk) bool {
+			select {
+			case chunkC <- chunk:
+				return true
+			case <-stopC:
+				return false
+			}
+		}
+		// 不在处理函数的goroutine中，上游的panic需要在这里恢复
+		defer func() {
+			if r := recover(); r != nil {
+				send(pipeChunk{err: fmt.Errorf("upstream panic: %v", r)})
+			}
+		}()
+		for text, err := range seq {
+			if !send(pipeChunk{text: text, err: err}) || err != nil {
+				return
+			}
+		}
+	}()
+
+	var tickC <-chan time.Time
+	if opts.FlushInterval > 0 {
+		ticker := time.NewTicker(opts.FlushInterval)
+		defer ticker.Stop()
+		tickC = ticker.C
+	}
+
+	var full, pending strings.Builder
+	flush := func() error {
+		if pending.Len() == 0 {
+			return nil
+		}
+		err := s.writeText(pending.String())
+		pending.Reset()
+		return err
+	}
+	// 写入失败时也关闭流，不等待流超时
+	fail := func(err error) (string, error) {
+		_ = s.closeText(full.String())
+		return full.String(), err
+	}
+
+	var upstreamErr error
+loop:
+	for {
+		select {
+		case chunk, ok := <-chunkC:
+			if !ok {
+				break loop
+			}
+			if chunk.err != nil {
+				upstreamErr = chunk.err
+				break loop
+			}
+			full.WriteString(chunk.text)
+			pending.WriteString(chunk.text)
+			if opts.FlushInterval <= 0 || (opts.FlushSize > 0 && pending.Len() >= opts.FlushSize) {
+				if err := flush(); err != nil {
+					return fail(err)
+				}
+			}
+		case <-tickC:
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		case <-s.doneC:
+			<-s.closedC // 等待关闭完成
+			return full.String(), s.closedErr()
+		}
+	}
+
+	if upstreamErr != nil && opts.ErrorMessage != "" {
+		full.WriteString(opts.ErrorMessage)
+		pending.WriteString(opts.ErrorMessage)
+	}
+	if err := flush(); err != nil {
+		return fail(err)
+	}
+	if err := s.closeText(full.String()); err != nil {
+		return full.String(), err
+	}
+	return full.String(), upstreamErr
+}
+
+// PipeChan 将 ch 中的文本写入流，ch 关闭后以完整的文本关闭流，见 Pipe
+func (s *Stream) PipeChan(ch <-chan string, opt ...PipeOption) (string, error) {
+	return s.Pipe(func(yield func(string, error) bool) {
+		for text := range ch {
+			if !yield(text, nil) {
+				return
+			}
+		}
+	}, opt...)
+}
+
+// writeText 写入文本，流没有设置编码方式时按文本消息编码后立即写入
+func (s *Stream) writeText(text string) error {
+	if s.opts.Encoder != nil {
+		_, err := s.WriteString(text)
+		return err
+	}
+	payload, err := TextStreamEncoder([]byte(text))
+	if err != nil {
+		return err
+	}
+	_, err = s.WriteMessage(payload)
+	return err
+}
+
+// closeText 以完整的文本关闭流
+func (s *Stream) closeText(text string) error {
+	if s.opts.Encoder != nil {
+		return s.CloseWithPayload([]byte(text))
+	}
+	payload, err := TextStreamEncoder([]byte(text))
+	if err != nil {
+		return err
+	}
+	return s.close(payload)
+}
+
+// closedErr 流关闭后写入返回的错误
+func (s *Stream) closedErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	return ErrStreamClosed
+}
@@ -0,0 +1,233 @@
+package pdk_test
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+)
+
+// chunks 依次返回 texts，err 不为nil时最后返回 err
+func chunks(err error, texts ...string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for _, text := range texts {
+			if !yield(text, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// closeText 按文本消息解码关闭流时的最终消息
+func closeText(t *testing.T, host *pdktest.FakeHost) string {
+	t.Helper()
+	closed := host.ClosedStreams()
+	if len(closed) != 1 {
+		t.Fatalf("close requests: %d", len(closed))
+	}
+	text := &pdk.PayloadText{}
+	if err := text.Decode(closed[0].Payload); err != nil {
+		t.Fatal(err)
+	}
+	return text.Content
+}
+
+func TestStreamPipe(t *testing.T) {
+	upstreamErr := errors.New("upstream failed")
+	tests := []struct {
+		name   string
+		seq    iter.Seq2[string, error]
+		opts   []pdk.PipeOption
+		writes []string
+		full   string
+		err    error
+	}{
+		{
+			name:   "no coalescing",
+			seq:    chunks(nil, "a", "b", "c"),
+			opts:   []pdk.PipeOption{pdk.PipeWithFlushInterval(0)},
+			writes: []string{"a", "b", "c"},
+			full:   "abc",
+		},
+		{
+			name:   "flush size",
+			seq:    chunks(nil, "a", "b", "c", "d"),
+			opts:   []pdk.PipeOption{pdk.PipeWithFlushInterval(time.Hour), pdk.PipeWithFlushSize(3)},
+			writes: []string{"abc", "d"},
+			full:   "abcd",
+		},
+		{
+			name:   "coalesced until the end",
+			seq:    chunks(nil, "a", "b"),
+			opts:   []pdk.PipeOption{pdk.PipeWithFlushInterval(time.Hour)},
+			writes: []string{"ab"},
+			full:   "ab",
+		},
+		{
+			name:   "upstream error with message",
+			seq:    chunks(upstreamErr, "a"),
+			opts:   []pdk.PipeOption{pdk.PipeWithFlushInterval(0), pdk.PipeWithErrorMessage("!error")},
+			writes: []string{"a", "!error"},
+			full:   "a!error",
+			err:    upstreamErr,
+		},
+		{
+			name:   "upstream error without message",
+			seq:    chunks(upstreamErr, "a"),
+			opts:   []pdk.PipeOption{pdk.PipeWithFlushInterval(0)},
+			writes: []string{"a"},
+			full:   "a",
+			err:    upstreamErr,
+		},
+		{
+			name:   "empty",
+			seq:    chunks(nil),
+			writes: nil,
+			full:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := pdktest.NewFakeHost()
+			stream := openStream(t, host)
+			full, err := stream.Pipe(tt.seq, tt.opts...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err: got %v, want %v", err, tt.err)
+			}
+			if full != tt.full {
+				t.Fatalf("full text: got %q, want %q", full, tt.full)
+			}
+			if got := writtenTexts(t, host); !slices.Equal(got, tt.writes) {
+				t.Fatalf("writes: got %q, want %q", got, tt.writes)
+			}
+			if got := closeText(t, host); got != tt.full {
+				t.Fatalf("close payload: got %q, want %q", got, tt.full)
+			}
+		})
+	}
+}
+
+func TestStreamPipeFlushInterval(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host)
+	ch := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := stream.PipeChan(ch, pdk.PipeWithFlushInterval(10*time.Millisecond)); err != nil {
+			t.Error(err)
+		}
+	}()
+	ch <- "a"
+	ch <- "b"
+	// 没有新的内容时按时间间隔写入
+	waitFor(t, func() bool { return len(host.StreamWrites()) == 1 })
+	close(ch)
+	<-done
+	if got := writtenTexts(t, host); !slices.Equal(got, []string{"ab"}) {
+		t.Fatalf("writes: %q", got)
+	}
+	if got := closeText(t, host); got != "ab" {
+		t.Fatalf("close payload: %q", got)
+	}
+}
+
+func TestStreamPipeEncoder(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithEncoder(func(chunk []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(chunk))), nil
+	}))
+	full, err := stream.Pipe(chunks(nil, "a", "b"), pdk.PipeWithFlushInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full != "ab" {
+		t.Fatalf("full text: %q", full)
+	}
+	if got := writtenPayloads(host); !slices.Equal(got, []string{"A", "B"}) {
+		t.Fatalf("writes: %q", got)
+	}
+	if got := string(host.ClosedStreams()[0].Payload); got != "AB" {
+		t.Fatalf("close payload: %q", got)
+	}
+}
+
+func TestStreamPipeUpstreamPanic(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host)
+	full, err := stream.Pipe(func(yield func(string, error) bool) {
+		yield("a", nil)
+		panic("boom")
+	}, pdk.PipeWithFlushInterval(0), pdk.PipeWithErrorMessage("!error"))
+	if err == nil || !strings.Contains(err.Error(), "upstream panic: boom") {
+		t.Fatalf("err: %v", err)
+	}
+	if full != "a!error" {
+		t.Fatalf("full text: %q", full)
+	}
+	if got := closeText(t, host); got != "a!error" {
+		t.Fatalf("close payload: %q", got)
+	}
+}
+
+func TestStreamPipeStreamClosed(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host)
+	ch := make(chan string)
+	defer close(ch)
+	type result struct {
+		full string
+		err  error
+	}
+	resultC := make(chan result, 1)
+	go func() {
+		full, err := stream.PipeChan(ch, pdk.PipeWithFlushInterval(0))
+		resultC <- result{full: full, err: err}
+	}()
+	ch <- "a"
+	waitFor(t, func() bool { return len(host.StreamWrites()) == 1 })
+
+	// 上游没有结束时流被关闭，Pipe 立即返回
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-resultC:
+		if !errors.Is(r.err, pdk.ErrStreamClosed) {
+			t.Fatalf("err: %v", r.err)
+		}
+		if r.full != "a" {
+			t.Fatalf("full text: %q", r.full)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pipe did not return after the stream was closed")
+	}
+	if n := len(host.ClosedStreams()); n != 1 {
+		t.Fatalf("close requests: %d", n)
+	}
+}
+
+func TestStreamPipeWriteError(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	writeErr := errors.New("write failed")
+	host.Handle("/stream/write", func(body []byte) ([]byte, error) {
+		return nil, writeErr
+	})
+	stream := openStream(t, host)
+	_, err := stream.Pipe(chunks(nil, "a", "b"), pdk.PipeWithFlushInterval(0))
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("err: %v", err)
+	}
+	// 写入失败时关闭流，不等待流超时
+	if n := len(host.ClosedStreams()); n != 1 {
+		t.Fatalf("close requests: %d", n)
+	}
+}
@@ -0,0 +1,92 @@
+package pdk
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ActiveStream 插件当前打开的流，用于调试
+type ActiveStream struct {
+	StreamNo     string    `json:"stream_no"`
+	ClientMsgNo  string    `json:"client_msg_no"`
+	FromUid      string    `json:"from_uid"`
+	ChannelId    string    `json:"channel_id"`
+	ChannelType  uint32    `json:"channel_type"`
+	OpenedAt     time.Time `json:"opened_at"`      // 打开时间
+	LastActiveAt time.Time `json:"last_active_at"` // 最后一次写入的时间
+}
+
+// streamRegistry 插件打开的、还未关闭的流
+type streamRegistry struct {
+	mu      sync.Mutex
+	streams map[*Stream]struct{}
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{
+		streams: map[*Stream]struct{}{},
+	}
+}
+
+// track 记录打开的流，流关闭后自动移除
+func (r *streamRegistry) track(stream *Stream) {
+	stream.onClose = r.remove
+	r.mu.Lock()
+	r.streams[stream] = struct{}{}
+	r.mu.Unlock()
+}
+
+func (r *streamRegistry) remove(stream *Stream) {
+	r.mu.Lock()
+	delete(r.streams, stream)
+	r.mu.Unlock()
+}
+
+// list 按打开时间排序的流
+func (r *streamRegistry) list() []*Stream {
+	r.mu.Lock()
+	streams := make([]*Stream, 0, len(r.streams))
+	for stream := range r.streams {
+		streams = append(streams, stream)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].openedAt.Before(streams[j].openedAt)
+	})
+	return streams
+}
+
+// closeAll 关闭所有未关闭的流，等待关闭完成
+func (r *streamRegistry) closeAll(reason string) {
+	var wg sync.WaitGroup
+	for _, stream := range r.list() {
+		wg.Add(1)
+		go func(stream *Stream) {
+			defer wg.Done()
+			stream.autoClose(reason)
+			// 已经在关闭中的流，等待关闭完成
+			<-stream.closedC
+		}(stream)
+	}
+	wg.Wait()
+}
+
+// ActiveStreams 插件当前打开的、还未关闭的流，按打开时间排序
+func (s *Server) ActiveStreams() []ActiveStream {
+	streams := s.streams.list()
+	actives := make([]ActiveStream, 0, len(streams))
+	for _, stream := range streams {
+		actives = append(actives, ActiveStream{
+			StreamNo:     stream.streamNo,
+			ClientMsgNo:  stream.streamInfo.ClientMsgNo,
+			FromUid:      stream.streamInfo.FromUid,
+			ChannelId:    stream.streamInfo.ChannelId,
+			ChannelType:  stream.streamInfo.ChannelType,
+			OpenedAt:     stream.openedAt,
+			LastActiveAt: stream.lastActiveAt(),
+		})
+	}
+	return actives
+}
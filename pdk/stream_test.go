@@ -0,0 +1,375 @@
+package pdk_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WuKongIM/go-pdk/pdk"
+	"github.com/WuKongIM/go-pdk/pdk/pdktest"
+	"github.com/WuKongIM/go-pdk/pdk/pluginproto"
+)
+
+func openStream(t *testing.T, host pdk.HostAPI, opt ...pdk.StreamOption) *pdk.Stream {
+	t.Helper()
+	stream, err := pdk.OpenStream(host, pdk.PersonChannel("u1"), "bot", opt...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// waitFor 等待 cond 成立，最多等待1秒
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("wait timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamNoWriteAfterClose(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	var closed, writeAfterClose atomic.Bool
+	host.Handle("/stream/write", func(body []byte) ([]byte, error) {
+		if closed.Load() {
+			writeAfterClose.Store(true)
+		}
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	})
+	host.Handle("/stream/close", func(body []byte) ([]byte, error) {
+		closed.Store(true)
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	})
+	stream := openStream(t, host)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := stream.WriteMessage([]byte("x")); err != nil {
+					if !errors.Is(err, pdk.ErrStreamClosed) {
+						t.Error(err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if writeAfterClose.Load() {
+		t.Fatal("stream write was sent after stream close")
+	}
+	if n := len(host.ClosedStreams()); n != 1 {
+		t.Fatalf("close requests: %d", n)
+	}
+}
+
+func TestStreamAutoClose(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   func(t *testing.T) []pdk.StreamOption
+		reason string
+	}{
+		{
+			name: "context",
+			opts: func(t *testing.T) []pdk.StreamOption {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				t.Cleanup(cancel)
+				return []pdk.StreamOption{pdk.StreamWithContext(ctx)}
+			},
+			reason: "context done",
+		},
+		{
+			name: "idle",
+			opts: func(t *testing.T) []pdk.StreamOption {
+				return []pdk.StreamOption{pdk.StreamWithIdleTimeout(20 * time.Millisecond)}
+			},
+			reason: "idle timeout",
+		},
+		{
+			name: "lifetime",
+			opts: func(t *testing.T) []pdk.StreamOption {
+				return []pdk.StreamOption{pdk.StreamWithMaxLifetime(20 * time.Millisecond)}
+			},
+			reason: "max lifetime exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := pdktest.NewFakeHost()
+			stream := openStream(t, host, tt.opts(t)...)
+			waitFor(t, func() bool { return len(host.ClosedStreams()) == 1 })
+
+			_, err := stream.Write([]byte("x"))
+			if !errors.Is(err, pdk.ErrStreamClosed) {
+				t.Fatalf("write after auto close: %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Fatalf("error %q does not contain the reason %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestStreamIdleTimeoutResetByWrites(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithIdleTimeout(40*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		time.Sleep(15 * time.Millisecond)
+		if _, err := stream.Write([]byte("x")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	waitFor(t, func() bool { return len(host.ClosedStreams()) == 1 })
+}
+
+// 默认的超时足够长，打开后短时间内不会被关闭
+func TestStreamNotClosedBeforeDefaultTimeouts(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := stream.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(host.ClosedStreams()); n != 0 {
+		t.Fatalf("close requests: %d", n)
+	}
+}
+
+// 设置为0时不限制
+func TestStreamTimeoutsDisabled(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithIdleTimeout(0), pdk.StreamWithMaxLifetime(0))
+	time.Sleep(30 * time.Millisecond)
+	if _, err := stream.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writtenPayloads 插件写入流的内容
+func writtenPayloads(host *pdktest.FakeHost) []string {
+	var payloads []string
+	for _, w := range host.StreamWrites() {
+		payloads = append(payloads, string(w.Payload))
+	}
+	return payloads
+}
+
+// writtenTexts 按文本消息解码插件写入流的内容
+func writtenTexts(t *testing.T, host *pdktest.FakeHost) []string {
+	t.Helper()
+	var texts []string
+	for _, w := range host.StreamWrites() {
+		text := &pdk.PayloadText{}
+		if err := text.Decode(w.Payload); err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, text.Content)
+	}
+	return texts
+}
+
+func TestStreamBuffering(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []pdk.StreamOption
+		writes []string
+		before []string // Close 之前写入服务端的内容
+		after  []string // Close 之后写入服务端的内容
+	}{
+		{
+			name:   "unbuffered",
+			writes: []string{"a", "b", "c"},
+			before: []string{"a", "b", "c"},
+			after:  []string{"a", "b", "c"},
+		},
+		{
+			name:   "flush size",
+			opts:   []pdk.StreamOption{pdk.StreamWithFlushSize(4)},
+			writes: []string{"ab", "cd", "e"},
+			before: []string{"abcd"},
+			after:  []string{"abcd", "e"},
+		},
+		{
+			name:   "flush size exceeded by one write",
+			opts:   []pdk.StreamOption{pdk.StreamWithFlushSize(2)},
+			writes: []string{"abcde"},
+			before: []string{"abcde"},
+			after:  []string{"abcde"},
+		},
+		{
+			name:   "flush interval",
+			opts:   []pdk.StreamOption{pdk.StreamWithFlushInterval(time.Hour)},
+			writes: []string{"a", "b", "c"},
+			after:  []string{"abc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := pdktest.NewFakeHost()
+			stream := openStream(t, host, tt.opts...)
+			for _, w := range tt.writes {
+				if n, err := stream.WriteString(w); err != nil || n != len(w) {
+					t.Fatalf("write %q: %d %v", w, n, err)
+				}
+			}
+			if got := writtenPayloads(host); !slices.Equal(got, tt.before) {
+				t.Fatalf("before close: got %q, want %q", got, tt.before)
+			}
+			if err := stream.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := writtenPayloads(host); !slices.Equal(got, tt.after) {
+				t.Fatalf("after close: got %q, want %q", got, tt.after)
+			}
+			// 缓冲的内容在关闭请求之前写入
+			calls := host.Calls("/stream/write", "/stream/close")
+			if last := calls[len(calls)-1]; last.Path != "/stream/close" {
+				t.Fatalf("last request: %s", last.Path)
+			}
+		})
+	}
+}
+
+func TestStreamFlushIntervalTimer(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithFlushInterval(20*time.Millisecond))
+	for _, w := range []string{"a", "b"} {
+		if _, err := stream.WriteString(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(host.StreamWrites()); n != 0 {
+		t.Fatalf("writes before the interval: %d", n)
+	}
+	waitFor(t, func() bool { return len(host.StreamWrites()) == 1 })
+	if got := writtenPayloads(host); got[0] != "ab" {
+		t.Fatalf("payload: %q", got[0])
+	}
+}
+
+func TestStreamFlush(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithFlushInterval(time.Hour))
+	if _, err := stream.WriteString("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// 没有缓冲的内容时不写入
+	if err := stream.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := writtenPayloads(host); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("payloads: %q", got)
+	}
+}
+
+func TestStreamEncoder(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithEncoder(pdk.TextStreamEncoder), pdk.StreamWithFlushSize(4))
+
+	// "你" 和 "好" 各3个字节，第一次写入到缓冲满时 "好" 只写入了一个字节
+	data := []byte("你好")
+	if _, err := stream.Write(data[:4]); err != nil {
+		t.Fatal(err)
+	}
+	if got := writtenTexts(t, host); !slices.Equal(got, []string{"你"}) {
+		t.Fatalf("texts: %q", got)
+	}
+	if _, err := stream.Write(data[4:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseWithPayload(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := writtenTexts(t, host); !slices.Equal(got, []string{"你", "好"}) {
+		t.Fatalf("texts: %q", got)
+	}
+	final := &pdk.PayloadText{}
+	if err := final.Decode(host.ClosedStreams()[0].Payload); err != nil {
+		t.Fatal(err)
+	}
+	if final.Content != "你好" {
+		t.Fatalf("close payload: %q", final.Content)
+	}
+}
+
+func TestStreamWriteMessage(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithFlushInterval(time.Hour), pdk.StreamWithClientMsgNo("client1"))
+	if stream.MessageId() != 0 {
+		t.Fatalf("message id before write: %d", stream.MessageId())
+	}
+	if _, err := stream.WriteString("a"); err != nil {
+		t.Fatal(err)
+	}
+	// 先写入缓冲的内容，再立即写入
+	resp, err := stream.WriteMessage([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := writtenPayloads(host); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("payloads: %q", got)
+	}
+	if resp.ClientMsgNo != "client1" || resp.MessageId == 0 || stream.MessageId() != resp.MessageId {
+		t.Fatalf("resp: %v, message id: %d", resp, stream.MessageId())
+	}
+}
+
+func TestStreamBackgroundFlushError(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	writeErr := errors.New("write failed")
+	host.Handle("/stream/write", func(body []byte) ([]byte, error) {
+		return nil, writeErr
+	})
+	stream := openStream(t, host, pdk.StreamWithFlushInterval(10*time.Millisecond))
+	if _, err := stream.WriteString("a"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(host.Calls("/stream/write")) == 1 })
+
+	// 后台写入的错误在下一次写入时返回
+	waitFor(t, func() bool {
+		_, err := stream.WriteString("b")
+		return err != nil && strings.Contains(err.Error(), writeErr.Error())
+	})
+}
+
+func TestStreamWithInfo(t *testing.T) {
+	host := pdktest.NewFakeHost()
+	stream := openStream(t, host, pdk.StreamWithClientMsgNo("client1"), pdk.StreamWithInfo(func(s *pluginproto.Stream) {
+		s.ClientMsgNo = "client2"
+		s.Header = &pluginproto.Header{NoPersist: true}
+	}))
+	opened := host.OpenedStreams()
+	if len(opened) != 1 || opened[0].ClientMsgNo != "client2" || !opened[0].Header.NoPersist {
+		t.Fatalf("opened streams: %v", opened)
+	}
+	// 写入时使用修改后的流信息
+	if _, err := stream.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if w := host.StreamWrites()[0]; w.ClientMsgNo != "client2" {
+		t.Fatalf("write client msg no: %s", w.ClientMsgNo)
+	}
+}
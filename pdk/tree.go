@@ -0,0 +1,143 @@
+package pdk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Param 路径参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路径参数列表
+type Params []Param
+
+// ByName 获取路径参数的值，不存在时返回空字符串
+func (ps Params) ByName(name string) string {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// node 路由树的节点，每个节点对应路径中的一段
+//
+// 支持三种类型的路径段：
+//
+//	/users        静态路径
+//	/users/:id    命名参数，匹配一段路径
+//	/static/*path 通配参数，匹配剩余的所有路径（只能出现在最后）
+//
+// 匹配优先级：静态路径 > 命名参数 > 通配参数
+type node struct {
+	children  map[string]*node // 静态子节点
+	param     *node            // 命名参数子节点
+	catchAll  *node            // 通配参数子节点
+	paramName string           // 参数名（param、catchAll节点）
+	handlers  []Handler        // 处理链，为nil表示该节点没有路由
+	fullPath  string           // 注册时的完整路径
+}
+
+func newNode() *node {
+	return &node{
+		children: make(map[string]*node),
+	}
+}
+
+func (n *node) addRoute(path string, handlers []Handler) {
+	segments := splitPath(path)
+	cur := n
+	for i, seg := range segments {
+		switch seg[0] {
+		case ':':
+			name := seg[1:]
+			if name == "" {
+				panic(fmt.Sprintf("param name must not be empty in path '%s'", path))
+			}
+			if cur.param == nil {
+				cur.param = newNode()
+				cur.param.paramName = name
+			} else if cur.param.paramName != name {
+				panic(fmt.Sprintf("param ':%s' in path '%s' conflicts with existing param ':%s'", name, path, cur.param.paramName))
+			}
+			cur = cur.param
+		case '*':
+			name := seg[1:]
+			if name == "" {
+				panic(fmt.Sprintf("catch-all name must not be empty in path '%s'", path))
+			}
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("catch-all must be the last segment in path '%s'", path))
+			}
+			if cur.catchAll == nil {
+				cur.catchAll = newNode()
+				cur.catchAll.paramName = name
+			} else if cur.catchAll.paramName != name {
+				panic(fmt.Sprintf("catch-all '*%s' in path '%s' conflicts with existing catch-all '*%s'", name, path, cur.catchAll.paramName))
+			}
+			cur = cur.catchAll
+		default:
+			child := cur.children[seg]
+			if child == nil {
+				child = newNode()
+				cur.children[seg] = child
+			}
+			cur = child
+		}
+	}
+	if cur.handlers != nil {
+		panic(fmt.Sprintf("handlers are already registered for path '%s'", path))
+	}
+	cur.handlers = handlers
+	cur.fullPath = path
+}
+
+// getValue 查找路径对应的节点，未找到时返回nil
+func (n *node) getValue(path string) (*node, Params) {
+	return n.find(splitPath(path), nil)
+}
+
+func (n *node) find(segments []string, params Params) (*node, Params) {
+	if len(segments) == 0 {
+		if n.handlers != nil {
+			return n, params
+		}
+		// 通配参数可以匹配空路径
+		if n.catchAll != nil && n.catchAll.handlers != nil {
+			return n.catchAll, append(params, Param{Key: n.catchAll.paramName, Value: "/"})
+		}
+		return nil, nil
+	}
+
+	seg := segments[0]
+	if child := n.children[seg]; child != nil {
+		if found, ps := child.find(segments[1:], params); found != nil {
+			return found, ps
+		}
+	}
+	if n.param != nil {
+		if found, ps := n.param.find(segments[1:], append(params, Param{Key: n.param.paramName, Value: seg})); found != nil {
+			return found, ps
+		}
+	}
+	if n.catchAll != nil && n.catchAll.handlers != nil {
+		return n.catchAll, append(params, Param{Key: n.catchAll.paramName, Value: "/" + strings.Join(segments, "/")})
+	}
+	return nil, nil
+}
+
+// splitPath 按 / 分割路径，忽略空的路径段（/a//b/ 等同于 /a/b）
+func splitPath(path string) []string {
+	parts := strings.Split(path, "/")
+	segments := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != "" {
+			segments = append(segments, p)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,103 @@
+package pdk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeGetValue(t *testing.T) {
+	root := newNode()
+	for _, p := range []string{
+		"/",
+		"/users",
+		"/users/new",
+		"/users/:id",
+		"/users/:id/posts/:postId",
+		"/static/*filepath",
+		"/files/*path",
+		"/files/readme",
+	} {
+		root.addRoute(p, []Handler{func(*HttpContext) {}})
+	}
+
+	tests := []struct {
+		path     string
+		fullPath string // 为空表示不匹配
+		params   Params
+	}{
+		{path: "/", fullPath: "/"},
+		{path: "/users", fullPath: "/users"},
+		{path: "/users/", fullPath: "/users"},
+		{path: "/users/new", fullPath: "/users/new"},
+		{path: "/users/42", fullPath: "/users/:id", params: Params{{Key: "id", Value: "42"}}},
+		{path: "/users/42/posts/7", fullPath: "/users/:id/posts/:postId", params: Params{{Key: "id", Value: "42"}, {Key: "postId", Value: "7"}}},
+		{path: "/users/42/posts", fullPath: ""},
+		{path: "/static/css/app.css", fullPath: "/static/*filepath", params: Params{{Key: "filepath", Value: "/css/app.css"}}},
+		{path: "/static", fullPath: "/static/*filepath", params: Params{{Key: "filepath", Value: "/"}}},
+		{path: "/files/readme", fullPath: "/files/readme"},
+		{path: "/files/readme/more", fullPath: "/files/*path", params: Params{{Key: "path", Value: "/readme/more"}}},
+		{path: "/a//users//42", fullPath: ""},
+		{path: "//users//42", fullPath: "/users/:id", params: Params{{Key: "id", Value: "42"}}},
+		{path: "/unknown", fullPath: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			n, params := root.getValue(tt.path)
+			if tt.fullPath == "" {
+				if n != nil {
+					t.Fatalf("expected no match, got %s", n.fullPath)
+				}
+				return
+			}
+			if n == nil {
+				t.Fatal("no match")
+			}
+			if n.fullPath != tt.fullPath {
+				t.Fatalf("full path: got %s, want %s", n.fullPath, tt.fullPath)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Fatalf("params: got %v, want %v", params, tt.params)
+			}
+		})
+	}
+}
+
+func TestNodeAddRouteConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		path     string
+	}{
+		{name: "empty param", path: "/users/:"},
+		{name: "empty catch-all", path: "/static/*"},
+		{name: "catch-all not last", path: "/static/*filepath/more"},
+		{name: "param name conflict", existing: "/users/:id", path: "/users/:name/posts"},
+		{name: "catch-all name conflict", existing: "/static/*filepath", path: "/static/*path"},
+		{name: "duplicate path", existing: "/users/:id", path: "/users/:id"},
+		{name: "duplicate path with trailing slash", existing: "/users", path: "/users/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newNode()
+			if tt.existing != "" {
+				root.addRoute(tt.existing, []Handler{func(*HttpContext) {}})
+			}
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic when adding %s", tt.path)
+				}
+			}()
+			root.addRoute(tt.path, []Handler{func(*HttpContext) {}})
+		})
+	}
+}
+
+func TestParamsByName(t *testing.T) {
+	params := Params{{Key: "id", Value: "42"}}
+	if v := params.ByName("id"); v != "42" {
+		t.Fatalf("id: %s", v)
+	}
+	if v := params.ByName("missing"); v != "" {
+		t.Fatalf("missing: %s", v)
+	}
+}